@@ -0,0 +1,330 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/config"
+)
+
+// Names of the limits reported in a ViolationError
+const (
+	LimitPath             = "path"
+	LimitTotalBytes       = "max_total_bytes"
+	LimitEntryBytes       = "max_entry_bytes"
+	LimitEntries          = "max_entries"
+	LimitCompressionRatio = "max_compression_ratio"
+)
+
+// compressionRatioFloor is the amount of uncompressed bytes read before the
+// compression ratio is enforced, small archives of highly compressible data
+// (tar headers are mostly zeros) would otherwise be rejected
+const compressionRatioFloor = 1024 * 1024
+
+// Format is the container format of an uploaded file
+type Format string
+
+// Different formats recognized by Detect
+const (
+	FormatTar    Format = "tar"
+	FormatTarGz  Format = "tar.gz"
+	FormatTarBz2 Format = "tar.bz2"
+	FormatTarXz  Format = "tar.xz"
+	FormatTarZst Format = "tar.zst"
+	FormatZip    Format = "zip"
+	FormatFile   Format = "file"
+)
+
+// ErrNotArchive is returned by Open when the content is not a supported archive
+var ErrNotArchive = errors.New("file is not a supported archive")
+
+// Archive is an uploaded file whose regular files can be walked
+type Archive interface {
+	// Format returns the detected format of the archive
+	Format() Format
+
+	// Walk calls fn for every regular file and directory of the archive while enforcing the limits
+	Walk(limits Limits, fn WalkFunc) error
+}
+
+// sniffSize is the amount of bytes needed to detect every supported format,
+// tar archives are recognized by the magic at offset 257 of the first header
+const sniffSize = 512
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	tarMagic   = []byte("ustar")
+	zipMagics  = [][]byte{[]byte("PK\x03\x04"), []byte("PK\x05\x06"), []byte("PK\x07\x08")}
+)
+
+func isTar(header []byte) bool {
+	return len(header) >= 257+len(tarMagic) && bytes.Equal(header[257:257+len(tarMagic)], tarMagic)
+}
+
+// Detect sniffs the format of the content from its magic bytes, compressed
+// streams only count as archives when they wrap a tarball
+func Detect(r io.ReaderAt, size int64) (Format, error) {
+	header := make([]byte, sniffSize)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	for _, magic := range zipMagics {
+		if bytes.HasPrefix(header, magic) {
+			return FormatZip, nil
+		}
+	}
+
+	if isTar(header) {
+		return FormatTar, nil
+	}
+
+	for _, format := range []Format{FormatTarGz, FormatTarBz2, FormatTarXz, FormatTarZst} {
+		if !bytes.HasPrefix(header, compressionMagic(format)) {
+			continue
+		}
+
+		// Peek into the decompressed stream to make sure it holds a tarball
+		decompressed, err := decompress(format, io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return FormatFile, nil
+		}
+		defer decompressed.Close()
+
+		inner := make([]byte, sniffSize)
+		n, _ := io.ReadFull(decompressed, inner)
+		if isTar(inner[:n]) {
+			return format, nil
+		}
+		return FormatFile, nil
+	}
+
+	return FormatFile, nil
+}
+
+// Open detects the format of the content and returns the matching archive,
+// ErrNotArchive is returned for anything that is not a supported archive
+func Open(r io.ReaderAt, size int64) (Archive, error) {
+	format, err := Detect(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatZip:
+		return &zipArchive{r: r, size: size}, nil
+	case FormatTar, FormatTarGz, FormatTarBz2, FormatTarXz, FormatTarZst:
+		return &tarArchive{format: format, r: r, size: size}, nil
+	default:
+		return nil, ErrNotArchive
+	}
+}
+
+// Limits bounds the resources an archive may use while being extracted,
+// a zero value disables the corresponding limit
+type Limits struct {
+	MaxTotalBytes       int64
+	MaxEntryBytes       int64
+	MaxEntries          int
+	MaxCompressionRatio float64
+}
+
+// NewLimits creates the extraction limits from the config
+func NewLimits(c *config.Config) Limits {
+	return Limits{
+		MaxTotalBytes:       c.ExtractMaxTotalBytes,
+		MaxEntryBytes:       c.ExtractMaxEntryBytes,
+		MaxEntries:          c.ExtractMaxEntries,
+		MaxCompressionRatio: c.ExtractMaxCompressionRatio,
+	}
+}
+
+// ViolationError is returned when an entry of the archive breaks one of the limits
+type ViolationError struct {
+	Entry  string `json:"entry"`
+	Limit  string `json:"limit"`
+	Actual string `json:"actual"`
+	Max    string `json:"max,omitempty"`
+}
+
+func (e *ViolationError) Error() string {
+	if e.Max == "" {
+		return fmt.Sprintf("archive entry %q violates %s: %s", e.Entry, e.Limit, e.Actual)
+	}
+	return fmt.Sprintf("archive entry %q violates %s: %s exceeds %s", e.Entry, e.Limit, e.Actual, e.Max)
+}
+
+// Entry describes a regular file or a directory found in an archive
+type Entry struct {
+	// Name is the cleaned, relative and slash separated path of the entry
+	Name    string
+	Size    int64
+	Mode    int64
+	ModTime time.Time
+	IsDir   bool
+
+	// Offset is where the content of a file starts in the decompressed tar stream, or
+	// where its compressed data starts in a zip file. It is -1 when unknown.
+	Offset int64
+}
+
+// WalkFunc is called for every regular file and directory of an archive, r yields
+// the content of a file and is only valid until WalkFunc returns, it is nil for directories
+type WalkFunc func(entry Entry, r io.Reader) error
+
+// SanitizeName cleans the name of an archive entry, rejecting absolute names
+// and names escaping the extraction folder
+func SanitizeName(name string) (string, error) {
+	violation := &ViolationError{Entry: name, Limit: LimitPath}
+
+	if strings.ContainsRune(name, 0) {
+		violation.Actual = "name contains a NUL byte"
+		return "", violation
+	}
+
+	// Archives created on Windows may use backslashes as separators
+	normalized := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(normalized, "/") || (len(normalized) >= 2 && normalized[1] == ':') {
+		violation.Actual = "absolute path"
+		return "", violation
+	}
+
+	for _, part := range strings.Split(normalized, "/") {
+		if part == ".." {
+			violation.Actual = "path traversal"
+			return "", violation
+		}
+	}
+
+	cleaned := path.Clean(normalized)
+	if cleaned == "." {
+		violation.Actual = "empty path"
+		return "", violation
+	}
+
+	return cleaned, nil
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// guard enforces the limits while the entries of an archive are read
+type guard struct {
+	limits     Limits
+	entries    int
+	totalBytes int64
+
+	// compressedBytes reports how many compressed bytes have been consumed so far
+	compressedBytes func() int64
+}
+
+func newGuard(limits Limits, compressedBytes func() int64) *guard {
+	return &guard{
+		limits:          limits,
+		compressedBytes: compressedBytes,
+	}
+}
+
+// enter checks the declared size of an entry before its content is read
+func (g *guard) enter(name string, size int64) error {
+	g.entries++
+	if g.limits.MaxEntries > 0 && g.entries > g.limits.MaxEntries {
+		return &ViolationError{
+			Entry:  name,
+			Limit:  LimitEntries,
+			Actual: fmt.Sprint(g.entries),
+			Max:    fmt.Sprint(g.limits.MaxEntries),
+		}
+	}
+
+	if g.limits.MaxEntryBytes > 0 && size > g.limits.MaxEntryBytes {
+		return &ViolationError{
+			Entry:  name,
+			Limit:  LimitEntryBytes,
+			Actual: fmt.Sprint(size),
+			Max:    fmt.Sprint(g.limits.MaxEntryBytes),
+		}
+	}
+
+	if g.limits.MaxTotalBytes > 0 && g.totalBytes+size > g.limits.MaxTotalBytes {
+		return &ViolationError{
+			Entry:  name,
+			Limit:  LimitTotalBytes,
+			Actual: fmt.Sprint(g.totalBytes + size),
+			Max:    fmt.Sprint(g.limits.MaxTotalBytes),
+		}
+	}
+
+	return nil
+}
+
+// reader wraps the content of an entry, enforcing the limits on the bytes
+// actually read since declared sizes can not always be trusted
+func (g *guard) reader(name string, r io.Reader) io.Reader {
+	return &guardedReader{guard: g, name: name, r: r}
+}
+
+type guardedReader struct {
+	guard *guard
+	name  string
+	r     io.Reader
+	n     int64
+}
+
+func (gr *guardedReader) Read(p []byte) (int, error) {
+	n, err := gr.r.Read(p)
+	gr.n += int64(n)
+	gr.guard.totalBytes += int64(n)
+
+	limits := gr.guard.limits
+	if limits.MaxEntryBytes > 0 && gr.n > limits.MaxEntryBytes {
+		return n, &ViolationError{
+			Entry:  gr.name,
+			Limit:  LimitEntryBytes,
+			Actual: fmt.Sprint(gr.n),
+			Max:    fmt.Sprint(limits.MaxEntryBytes),
+		}
+	}
+
+	if limits.MaxTotalBytes > 0 && gr.guard.totalBytes > limits.MaxTotalBytes {
+		return n, &ViolationError{
+			Entry:  gr.name,
+			Limit:  LimitTotalBytes,
+			Actual: fmt.Sprint(gr.guard.totalBytes),
+			Max:    fmt.Sprint(limits.MaxTotalBytes),
+		}
+	}
+
+	if limits.MaxCompressionRatio > 0 && gr.guard.compressedBytes != nil && gr.guard.totalBytes > compressionRatioFloor {
+		ratio := float64(gr.guard.totalBytes) / float64(gr.guard.compressedBytes()+1)
+		if ratio > limits.MaxCompressionRatio {
+			return n, &ViolationError{
+				Entry:  gr.name,
+				Limit:  LimitCompressionRatio,
+				Actual: fmt.Sprintf("%.1f", ratio),
+				Max:    fmt.Sprintf("%.1f", limits.MaxCompressionRatio),
+			}
+		}
+	}
+
+	return n, err
+}
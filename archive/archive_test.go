@@ -0,0 +1,452 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+// sampleTarBz2 holds dir/, dir/a.txt and b.txt, the standard library has no bzip2 writer
+const sampleTarBz2 = "QlpoOTFBWSZTWQ1dgyIAAKb7gMmAABBAAf+AAIx0IB5ACAggAHISVG1DQBoAD1BFJMoZomTah6gD97McjWGare8uKCm1o9NjHMedrSdHIawiEgYDPSpuUEKMCvbveas3rvG0tehcwrTCESJJqoMk+26kzcTdmq8Pk46+HVxahB+LuSKcKEgGrsGRAA=="
+
+type testEntry struct {
+	name     string
+	typeflag byte
+	body     []byte
+}
+
+func createTar(t *testing.T, entries []testEntry) []byte {
+	var buffer bytes.Buffer
+	tarWriter := tar.NewWriter(&buffer)
+
+	for _, entry := range entries {
+		typeflag := entry.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:     entry.name,
+			Typeflag: typeflag,
+			Mode:     0644,
+			Size:     int64(len(entry.body)),
+		})
+		require.NoError(t, err)
+
+		_, err = tarWriter.Write(entry.body)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tarWriter.Close())
+	return buffer.Bytes()
+}
+
+func compress(t *testing.T, data []byte, newWriter func(w io.Writer) (io.WriteCloser, error)) []byte {
+	var buffer bytes.Buffer
+	writer, err := newWriter(&buffer)
+	require.NoError(t, err)
+
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func gzipWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func createTarGz(t *testing.T, entries []testEntry) []byte {
+	return compress(t, createTar(t, entries), gzipWriter)
+}
+
+func createZip(t *testing.T, entries []testEntry) []byte {
+	var buffer bytes.Buffer
+	zipWriter := zip.NewWriter(&buffer)
+
+	for _, entry := range entries {
+		writer, err := zipWriter.Create(entry.name)
+		require.NoError(t, err)
+
+		_, err = writer.Write(entry.body)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, zipWriter.Close())
+	return buffer.Bytes()
+}
+
+func walkAll(upload Archive, limits Limits) (map[string]string, error) {
+	files := make(map[string]string)
+	err := upload.Walk(limits, func(entry Entry, r io.Reader) error {
+		if entry.IsDir {
+			files[entry.Name+"/"] = ""
+			return nil
+		}
+
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		files[entry.Name] = string(content)
+		return nil
+	})
+	return files, err
+}
+
+func extractAll(data []byte, limits Limits) (map[string]string, error) {
+	upload, err := Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return walkAll(upload, limits)
+}
+
+func requireViolation(t *testing.T, err error, entry string, limit string) {
+	var violation *ViolationError
+	require.True(t, errors.As(err, &violation), "expected a violation, got %v", err)
+	require.Equal(t, entry, violation.Entry)
+	require.Equal(t, limit, violation.Limit)
+}
+
+func TestSanitizeName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+		valid    bool
+	}{
+		{name: "a.txt", expected: "a.txt", valid: true},
+		{name: "./dir/a.txt", expected: "dir/a.txt", valid: true},
+		{name: "dir//sub/./a.txt", expected: "dir/sub/a.txt", valid: true},
+		{name: "dir\\a.txt", expected: "dir/a.txt", valid: true},
+		{name: "../a.txt"},
+		{name: "dir/../../a.txt"},
+		{name: "dir/../a.txt"},
+		{name: "..\\a.txt"},
+		{name: "/etc/passwd"},
+		{name: "C:/Windows/a.txt"},
+		{name: "."},
+		{name: "a\x00.txt"},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			name, err := SanitizeName(tc.name)
+			if !tc.valid {
+				requireViolation(t, err, tc.name, LimitPath)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, name)
+		})
+	}
+}
+
+func TestOpenTarGz(t *testing.T) {
+	data := createTarGz(t, []testEntry{
+		{name: "dir/", typeflag: tar.TypeDir},
+		{name: "dir/a.txt", body: []byte("a")},
+		{name: "./b.txt", body: []byte("bb")},
+	})
+
+	files, err := extractAll(data, Limits{MaxTotalBytes: 3, MaxEntryBytes: 2, MaxEntries: 3})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"dir/": "", "dir/a.txt": "a", "b.txt": "bb"}, files)
+}
+
+func TestWalkLimits(t *testing.T) {
+	testCases := []struct {
+		name    string
+		entries []testEntry
+		limits  Limits
+		entry   string
+		limit   string
+	}{
+		{
+			name:    "PathTraversal",
+			entries: []testEntry{{name: "../../evil.sh", body: []byte("x")}},
+			entry:   "../../evil.sh",
+			limit:   LimitPath,
+		},
+		{
+			name:    "AbsolutePath",
+			entries: []testEntry{{name: "/etc/cron.d/evil", body: []byte("x")}},
+			entry:   "/etc/cron.d/evil",
+			limit:   LimitPath,
+		},
+		{
+			name:    "EntryBytes",
+			entries: []testEntry{{name: "a.txt", body: []byte("a")}, {name: "big.txt", body: []byte("big")}},
+			limits:  Limits{MaxEntryBytes: 2},
+			entry:   "big.txt",
+			limit:   LimitEntryBytes,
+		},
+		{
+			name:    "TotalBytes",
+			entries: []testEntry{{name: "a.txt", body: []byte("aa")}, {name: "b.txt", body: []byte("bb")}},
+			limits:  Limits{MaxTotalBytes: 3},
+			entry:   "b.txt",
+			limit:   LimitTotalBytes,
+		},
+		{
+			name:    "Entries",
+			entries: []testEntry{{name: "a.txt"}, {name: "dir/", typeflag: tar.TypeDir}, {name: "b.txt"}},
+			limits:  Limits{MaxEntries: 2},
+			entry:   "b.txt",
+			limit:   LimitEntries,
+		},
+		{
+			name:    "CompressionRatio",
+			entries: []testEntry{{name: "zeros.bin", body: make([]byte, 4*compressionRatioFloor)}},
+			limits:  Limits{MaxCompressionRatio: 100},
+			entry:   "zeros.bin",
+			limit:   LimitCompressionRatio,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := extractAll(createTarGz(t, tc.entries), tc.limits)
+			requireViolation(t, err, tc.entry, tc.limit)
+		})
+	}
+}
+
+func TestWalkCompressionRatioBelowFloor(t *testing.T) {
+	data := createTarGz(t, []testEntry{{name: "zeros.bin", body: make([]byte, compressionRatioFloor/2)}})
+
+	files, err := extractAll(data, Limits{MaxCompressionRatio: 100})
+	require.NoError(t, err)
+	require.Len(t, files["zeros.bin"], compressionRatioFloor/2)
+}
+
+func TestOpenFormats(t *testing.T) {
+	entries := []testEntry{
+		{name: "dir/", typeflag: tar.TypeDir},
+		{name: "dir/a.txt", body: []byte("a")},
+		{name: "b.txt", body: []byte("bb")},
+	}
+	tarball := createTar(t, entries)
+	expected := map[string]string{"dir/": "", "dir/a.txt": "a", "b.txt": "bb"}
+
+	sampleBz2, err := base64.StdEncoding.DecodeString(sampleTarBz2)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		data   []byte
+		format Format
+	}{
+		{name: "Tar", data: tarball, format: FormatTar},
+		{name: "TarGz", data: compress(t, tarball, gzipWriter), format: FormatTarGz},
+		{name: "TarBz2", data: sampleBz2, format: FormatTarBz2},
+		{
+			name: "TarXz",
+			data: compress(t, tarball, func(w io.Writer) (io.WriteCloser, error) {
+				return xz.NewWriter(w)
+			}),
+			format: FormatTarXz,
+		},
+		{
+			name: "TarZst",
+			data: compress(t, tarball, func(w io.Writer) (io.WriteCloser, error) {
+				return zstd.NewWriter(w)
+			}),
+			format: FormatTarZst,
+		},
+		{name: "Zip", data: createZip(t, entries), format: FormatZip},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			upload, err := Open(bytes.NewReader(tc.data), int64(len(tc.data)))
+			require.NoError(t, err)
+			require.Equal(t, tc.format, upload.Format())
+
+			files, err := walkAll(upload, Limits{})
+			require.NoError(t, err)
+			require.Equal(t, expected, files)
+		})
+	}
+}
+
+func TestOpenNotArchive(t *testing.T) {
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Text", data: []byte(strings.Repeat("not a tarball", 10))},
+		{name: "Empty", data: []byte{}},
+		{name: "GzipWithoutTar", data: compress(t, []byte("just a log file"), gzipWriter)},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Open(bytes.NewReader(tc.data), int64(len(tc.data)))
+			require.ErrorIs(t, err, ErrNotArchive)
+		})
+	}
+}
+
+func TestZipLimits(t *testing.T) {
+	data := createZip(t, []testEntry{{name: "../evil.sh", body: []byte("x")}})
+	_, err := extractAll(data, Limits{})
+	requireViolation(t, err, "../evil.sh", LimitPath)
+
+	data = createZip(t, []testEntry{{name: "zeros.bin", body: make([]byte, 4*compressionRatioFloor)}})
+	_, err = extractAll(data, Limits{MaxCompressionRatio: 100})
+	requireViolation(t, err, "zeros.bin", LimitCompressionRatio)
+}
+
+func TestSingle(t *testing.T) {
+	data := createTarGz(t, []testEntry{{name: "a.txt", body: []byte("a")}})
+
+	upload := Single(bytes.NewReader(data), int64(len(data)), "backup.tar.gz")
+	require.Equal(t, FormatFile, upload.Format())
+
+	files, err := walkAll(upload, Limits{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"backup.tar.gz": string(data)}, files)
+
+	_, err = walkAll(upload, Limits{MaxEntryBytes: 1})
+	requireViolation(t, err, "backup.tar.gz", LimitEntryBytes)
+}
+
+func TestWriter(t *testing.T) {
+	modTime := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, format := range []Format{FormatZip, FormatTarGz} {
+		t.Run(string(format), func(t *testing.T) {
+			var buffer bytes.Buffer
+			writer, err := NewWriter(format, &buffer)
+			require.NoError(t, err)
+
+			require.NoError(t, writer.WriteDir("dir", modTime))
+			require.NoError(t, writer.WriteFile("dir/a.txt", 5, 0600, modTime, strings.NewReader("hello")))
+			require.NoError(t, writer.WriteFile("b.txt", 0, 0644, modTime, strings.NewReader("")))
+			require.NoError(t, writer.Close())
+
+			upload, err := Open(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+			require.NoError(t, err)
+			require.Equal(t, format, upload.Format())
+
+			walked, err := walkAll(upload, Limits{})
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"dir/": "", "dir/a.txt": "hello", "b.txt": ""}, walked)
+		})
+	}
+
+	_, err := NewWriter(FormatTarBz2, io.Discard)
+	require.Error(t, err)
+}
+
+func TestTarGzWriterSizeMismatch(t *testing.T) {
+	writer, err := NewWriter(FormatTarGz, io.Discard)
+	require.NoError(t, err)
+
+	err = writer.WriteFile("a.txt", 10, 0644, time.Now(), strings.NewReader("short"))
+	require.Error(t, err)
+}
+
+func TestOpenEntry(t *testing.T) {
+	tarball := createTar(t, []testEntry{
+		{name: "dir/", typeflag: tar.TypeDir},
+		{name: "dir/a.txt", body: []byte("a")},
+		{name: "b.txt", body: bytes.Repeat([]byte("b"), 1000)},
+	})
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Tar", data: tarball},
+		{name: "TarGz", data: compress(t, tarball, gzipWriter)},
+		{name: "Zip", data: createZip(t, []testEntry{{name: "dir/a.txt", body: []byte("a")}, {name: "b.txt", body: bytes.Repeat([]byte("b"), 1000)}})},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			r, size := bytes.NewReader(tc.data), int64(len(tc.data))
+			upload, err := Open(r, size)
+			require.NoError(t, err)
+
+			var indexed []Entry
+			err = upload.Walk(Limits{}, func(entry Entry, _ io.Reader) error {
+				if !entry.IsDir {
+					require.GreaterOrEqual(t, entry.Offset, int64(0))
+					indexed = append(indexed, entry)
+				}
+				return nil
+			})
+			require.NoError(t, err)
+			require.Len(t, indexed, 2)
+
+			for _, entry := range indexed {
+				// Looking the entry up by name must give the same content as its offset
+				for _, offset := range []int64{entry.Offset, -1} {
+					lookup := entry
+					lookup.Offset = offset
+
+					reader, err := OpenEntry(r, size, upload.Format(), lookup)
+					require.NoError(t, err)
+					content, err := io.ReadAll(reader)
+					require.NoError(t, err)
+					require.NoError(t, reader.Close())
+
+					expected := "a"
+					if entry.Name == "b.txt" {
+						expected = strings.Repeat("b", 1000)
+					}
+					require.Equal(t, expected, string(content))
+				}
+			}
+
+			_, err = OpenEntry(r, size, upload.Format(), Entry{Name: "missing.txt", Offset: -1})
+			require.ErrorIs(t, err, ErrEntryNotFound)
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	data := createTarGz(t, []testEntry{
+		{name: "dir/", typeflag: tar.TypeDir},
+		{name: "dir/a.txt", body: []byte("a")},
+		{name: "b.txt", body: []byte("bb")},
+		{name: "dir/a.txt", body: []byte("aaa")},
+	})
+	upload, err := Open(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	entries, err := Index(upload, Limits{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, "dir", entries[0].Name)
+	require.True(t, entries[0].IsDir)
+	require.Equal(t, "dir/a.txt", entries[1].Name)
+	require.Equal(t, int64(3), entries[1].Size)
+	require.Equal(t, "b.txt", entries[2].Name)
+
+	_, err = Index(upload, Limits{MaxTotalBytes: 5})
+	requireViolation(t, err, "dir/a.txt", LimitTotalBytes)
+}
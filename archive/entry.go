@@ -0,0 +1,133 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrEntryNotFound is returned by OpenEntry when the archive has no such regular file
+var ErrEntryNotFound = errors.New("entry not found in archive")
+
+// readCloser pairs a reader with the closer of the stream it reads from
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Index lists the regular files and directories of an archive without reading their
+// content. Tarballs are still decompressed to reach every header, so the declared sizes
+// count towards the total bytes limit. An entry appearing more than once is listed
+// once, with the last occurrence winning like it does on extraction.
+func Index(a Archive, limits Limits) ([]Entry, error) {
+	var entries []Entry
+	positions := make(map[string]int)
+	var totalBytes int64
+
+	err := a.Walk(limits, func(entry Entry, _ io.Reader) error {
+		totalBytes += entry.Size
+		if limits.MaxTotalBytes > 0 && totalBytes > limits.MaxTotalBytes {
+			return &ViolationError{
+				Entry:  entry.Name,
+				Limit:  LimitTotalBytes,
+				Actual: fmt.Sprint(totalBytes),
+				Max:    fmt.Sprint(limits.MaxTotalBytes),
+			}
+		}
+
+		if i, ok := positions[entry.Name]; ok {
+			entries[i] = entry
+			return nil
+		}
+		positions[entry.Name] = len(entries)
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// OpenEntry returns the content of a single regular file of an archive without
+// extracting the others. The offset of the entry is used when it is known: plain
+// tarballs are read in place and compressed ones are decompressed up to it, zip
+// files are looked up in their central directory.
+func OpenEntry(r io.ReaderAt, size int64, format Format, entry Entry) (io.ReadCloser, error) {
+	switch format {
+	case FormatZip:
+		return openZipEntry(r, size, entry)
+	case FormatTar, FormatTarGz, FormatTarBz2, FormatTarXz, FormatTarZst:
+		return openTarEntry(r, size, format, entry)
+	default:
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+func openTarEntry(r io.ReaderAt, size int64, format Format, entry Entry) (io.ReadCloser, error) {
+	if format == FormatTar && entry.Offset >= 0 {
+		if entry.Offset+entry.Size > size {
+			return nil, ErrEntryNotFound
+		}
+		return io.NopCloser(io.NewSectionReader(r, entry.Offset, entry.Size)), nil
+	}
+
+	decompressed, err := decompress(format, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Offset >= 0 {
+		if _, err := io.CopyN(io.Discard, decompressed, entry.Offset); err != nil {
+			decompressed.Close()
+			if err == io.EOF {
+				return nil, ErrEntryNotFound
+			}
+			return nil, err
+		}
+		return &readCloser{Reader: io.LimitReader(decompressed, entry.Size), Closer: decompressed}, nil
+	}
+
+	// Without an offset, walk the headers up to the entry
+	tarReader := tar.NewReader(decompressed)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			decompressed.Close()
+			return nil, ErrEntryNotFound
+		}
+		if err != nil {
+			decompressed.Close()
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if name, err := SanitizeName(header.Name); err == nil && name == entry.Name {
+			return &readCloser{Reader: tarReader, Closer: decompressed}, nil
+		}
+	}
+}
+
+func openZipEntry(r io.ReaderAt, size int64, entry Entry) (io.ReadCloser, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range zipReader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		name, err := SanitizeName(file.Name)
+		if err != nil || name != entry.Name {
+			continue
+		}
+		return file.Open()
+	}
+
+	return nil, ErrEntryNotFound
+}
@@ -0,0 +1,45 @@
+package archive
+
+import (
+	"io"
+	"path"
+	"time"
+)
+
+// singleFile is an upload stored as it is, without extracting it
+type singleFile struct {
+	r    io.ReaderAt
+	size int64
+	name string
+}
+
+// Single wraps an upload so it is stored as a single file named after name,
+// even when its content is an archive
+func Single(r io.ReaderAt, size int64, name string) Archive {
+	return &singleFile{r: r, size: size, name: name}
+}
+
+func (s *singleFile) Format() Format {
+	return FormatFile
+}
+
+func (s *singleFile) Walk(limits Limits, fn WalkFunc) error {
+	name, err := SanitizeName(path.Base(s.name))
+	if err != nil {
+		return err
+	}
+
+	g := newGuard(limits, nil)
+	if err := g.enter(name, s.size); err != nil {
+		return err
+	}
+
+	entry := Entry{
+		Name:    name,
+		Size:    s.size,
+		Mode:    0644,
+		ModTime: time.Now(),
+		Offset:  0,
+	}
+	return fn(entry, g.reader(name, io.NewSectionReader(s.r, 0, s.size)))
+}
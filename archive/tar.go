@@ -0,0 +1,143 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compressionMagic returns the magic bytes of the compression used by a tar format
+func compressionMagic(format Format) []byte {
+	switch format {
+	case FormatTarGz:
+		return gzipMagic
+	case FormatTarBz2:
+		return bzip2Magic
+	case FormatTarXz:
+		return xzMagic
+	case FormatTarZst:
+		return zstdMagic
+	default:
+		return nil
+	}
+}
+
+// decompress wraps r with the decompressor of a tar format
+func decompress(format Format, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case FormatTar:
+		return io.NopCloser(r), nil
+	case FormatTarGz:
+		return gzip.NewReader(r)
+	case FormatTarBz2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case FormatTarXz:
+		xzReader, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xzReader), nil
+	case FormatTarZst:
+		zstdReader, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zstdReader.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported tar format %q", format)
+	}
+}
+
+// tarArchive is a tarball, optionally wrapped in a compressed stream
+type tarArchive struct {
+	format Format
+	r      io.ReaderAt
+	size   int64
+}
+
+func (t *tarArchive) Format() Format {
+	return t.format
+}
+
+func (t *tarArchive) Walk(limits Limits, fn WalkFunc) error {
+	compressed := &countingReader{r: io.NewSectionReader(t.r, 0, t.size)}
+
+	decompressed, err := decompress(t.format, compressed)
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
+
+	// The tar reader consumes whole blocks, so the position in the decompressed
+	// stream after a header is the offset of the entry content
+	position := &countingReader{r: decompressed}
+	g := newGuard(limits, func() int64 { return compressed.n })
+	return walkTar(tar.NewReader(position), func() int64 { return position.n }, g, fn)
+}
+
+func walkTar(tarReader *tar.Reader, position func() int64, g *guard, fn WalkFunc) error {
+	// Iterate over each file in the tar archive
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			// End of archive
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name, err := SanitizeName(header.Name)
+		if err != nil {
+			return err
+		}
+
+		// Directories are reported without content
+		if header.Typeflag == tar.TypeDir {
+			if err := g.enter(name, 0); err != nil {
+				return err
+			}
+
+			entry := Entry{
+				Name:    name,
+				Mode:    header.Mode,
+				ModTime: header.ModTime,
+				IsDir:   true,
+				Offset:  -1,
+			}
+			if err := fn(entry, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Ensure the file is a regular file (not a symbolic link or a device),
+		// other entries still count towards the entry limit
+		if header.Typeflag != tar.TypeReg {
+			if err := g.enter(name, 0); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := g.enter(name, header.Size); err != nil {
+			return err
+		}
+
+		entry := Entry{
+			Name:    name,
+			Size:    header.Size,
+			Mode:    header.Mode,
+			ModTime: header.ModTime,
+			Offset:  position(),
+		}
+		if err := fn(entry, g.reader(name, tarReader)); err != nil {
+			return err
+		}
+	}
+}
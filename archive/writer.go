@@ -0,0 +1,116 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// Writer streams an archive to an underlying writer, entries are written as they come
+// so the archive is never held in memory or on disk
+type Writer interface {
+	// WriteDir adds a directory entry
+	WriteDir(name string, modTime time.Time) error
+
+	// WriteFile adds a regular file of size bytes read from r
+	WriteFile(name string, size int64, mode fs.FileMode, modTime time.Time, r io.Reader) error
+
+	// Close writes the end of the archive, it does not close the underlying writer
+	Close() error
+}
+
+// NewWriter creates a Writer producing an archive in format, only FormatZip and
+// FormatTarGz can be written
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatZip:
+		return &zipWriter{w: zip.NewWriter(w)}, nil
+	case FormatTarGz:
+		gzipWriter := gzip.NewWriter(w)
+		return &tarGzWriter{gzip: gzipWriter, tar: tar.NewWriter(gzipWriter)}, nil
+	default:
+		return nil, fmt.Errorf("can not write %q archives", format)
+	}
+}
+
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func (z *zipWriter) WriteDir(name string, modTime time.Time) error {
+	_, err := z.w.CreateHeader(&zip.FileHeader{
+		Name:     strings.TrimSuffix(name, "/") + "/",
+		Method:   zip.Store,
+		Modified: modTime,
+	})
+	return err
+}
+
+func (z *zipWriter) WriteFile(name string, _ int64, mode fs.FileMode, modTime time.Time, r io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	}
+	header.SetMode(mode)
+
+	writer, err := z.w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, r)
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.w.Close()
+}
+
+type tarGzWriter struct {
+	gzip *gzip.Writer
+	tar  *tar.Writer
+}
+
+func (t *tarGzWriter) WriteDir(name string, modTime time.Time) error {
+	return t.tar.WriteHeader(&tar.Header{
+		Name:     strings.TrimSuffix(name, "/") + "/",
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+		ModTime:  modTime,
+	})
+}
+
+func (t *tarGzWriter) WriteFile(name string, size int64, mode fs.FileMode, modTime time.Time, r io.Reader) error {
+	err := t.tar.WriteHeader(&tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     int64(mode.Perm()),
+		Size:     size,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Tar headers carry the size, the content must match it exactly
+	written, err := io.Copy(t.tar, io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return fmt.Errorf("%s: expected %d bytes, got %d", name, size, written)
+	}
+	return nil
+}
+
+func (t *tarGzWriter) Close() error {
+	if err := t.tar.Close(); err != nil {
+		return err
+	}
+	return t.gzip.Close()
+}
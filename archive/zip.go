@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"archive/zip"
+	"io"
+)
+
+// zipArchive is a zip file, its central directory is read through io.ReaderAt
+type zipArchive struct {
+	r    io.ReaderAt
+	size int64
+}
+
+func (z *zipArchive) Format() Format {
+	return FormatZip
+}
+
+func (z *zipArchive) Walk(limits Limits, fn WalkFunc) error {
+	zipReader, err := zip.NewReader(z.r, z.size)
+	if err != nil {
+		return err
+	}
+
+	// Zip entries are compressed one by one, so the ratio is computed from
+	// the compressed size of the entries entered so far
+	var compressedBytes int64
+	g := newGuard(limits, func() int64 { return compressedBytes })
+
+	for _, file := range zipReader.File {
+		name, err := SanitizeName(file.Name)
+		if err != nil {
+			return err
+		}
+
+		// Directories are reported without content
+		if file.FileInfo().IsDir() {
+			if err := g.enter(name, 0); err != nil {
+				return err
+			}
+
+			entry := Entry{
+				Name:    name,
+				Mode:    int64(file.Mode().Perm()),
+				ModTime: file.Modified,
+				IsDir:   true,
+				Offset:  -1,
+			}
+			if err := fn(entry, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Ensure the file is a regular file (not a symbolic link),
+		// other entries still count towards the entry limit
+		if !file.Mode().IsRegular() {
+			if err := g.enter(name, 0); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The declared size can not be trusted, the guard also enforces the
+		// limits on the bytes actually decompressed
+		size := int64(file.UncompressedSize64)
+		if err := g.enter(name, size); err != nil {
+			return err
+		}
+		compressedBytes += int64(file.CompressedSize64)
+
+		if err := z.walkFile(g, name, size, file, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (z *zipArchive) walkFile(g *guard, name string, size int64, file *zip.File, fn WalkFunc) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	offset, err := file.DataOffset()
+	if err != nil {
+		offset = -1
+	}
+
+	entry := Entry{
+		Name:    name,
+		Size:    size,
+		Mode:    int64(file.Mode().Perm()),
+		ModTime: file.Modified,
+		Offset:  offset,
+	}
+	return fn(entry, g.reader(name, reader))
+}
@@ -15,6 +15,61 @@ type Config struct {
 	TokenSymmetricKey    string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
 	AccessTokenDuration  time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
 	RefreshTokenDuration time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	StorageBackend       string        `mapstructure:"STORAGE_BACKEND"`
+	StorageLocalPath     string        `mapstructure:"STORAGE_LOCAL_PATH"`
+	S3Endpoint           string        `mapstructure:"S3_ENDPOINT"`
+	S3Bucket             string        `mapstructure:"S3_BUCKET"`
+	S3Region             string        `mapstructure:"S3_REGION"`
+	S3AccessKeyID        string        `mapstructure:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey    string        `mapstructure:"S3_SECRET_ACCESS_KEY"`
+	S3UseSSL             bool          `mapstructure:"S3_USE_SSL"`
+	S3ForcePathStyle     bool          `mapstructure:"S3_FORCE_PATH_STYLE"`
+	S3PartSize           int64         `mapstructure:"S3_PART_SIZE"`
+	S3PresignDownloads   bool          `mapstructure:"S3_PRESIGN_DOWNLOADS"`
+	S3PresignExpiry      time.Duration `mapstructure:"S3_PRESIGN_EXPIRY"`
+	ShareLinkKey         string        `mapstructure:"SHARE_LINK_KEY"`
+	ShareLinkDuration    time.Duration `mapstructure:"SHARE_LINK_DURATION"`
+	ShareLinkMaxDuration time.Duration `mapstructure:"SHARE_LINK_MAX_DURATION"`
+
+	ExtractMaxTotalBytes       int64   `mapstructure:"EXTRACT_MAX_TOTAL_BYTES"`
+	ExtractMaxEntryBytes       int64   `mapstructure:"EXTRACT_MAX_ENTRY_BYTES"`
+	ExtractMaxEntries          int     `mapstructure:"EXTRACT_MAX_ENTRIES"`
+	ExtractMaxCompressionRatio float64 `mapstructure:"EXTRACT_MAX_COMPRESSION_RATIO"`
+
+	JobWorkers      int           `mapstructure:"JOB_WORKERS"`
+	JobPollInterval time.Duration `mapstructure:"JOB_POLL_INTERVAL"`
+	BlobGCInterval  time.Duration `mapstructure:"BLOB_GC_INTERVAL"`
+
+	TrashRetention     time.Duration `mapstructure:"TRASH_RETENTION"`
+	TrashPurgeInterval time.Duration `mapstructure:"TRASH_PURGE_INTERVAL"`
+
+	QuotaDefaultMaxBytes int64 `mapstructure:"QUOTA_DEFAULT_MAX_BYTES"`
+	QuotaDefaultMaxFiles int64 `mapstructure:"QUOTA_DEFAULT_MAX_FILES"`
+
+	TusUploadPath   string        `mapstructure:"TUS_UPLOAD_PATH"`
+	TusMaxSize      int64         `mapstructure:"TUS_MAX_SIZE"`
+	TusUploadExpiry time.Duration `mapstructure:"TUS_UPLOAD_EXPIRY"`
+
+	MailerBackend string `mapstructure:"MAILER_BACKEND"`
+	MailerFrom    string `mapstructure:"MAILER_FROM"`
+	MailerLogPath string `mapstructure:"MAILER_LOG_PATH"`
+	SMTPHost      string `mapstructure:"SMTP_HOST"`
+	SMTPPort      int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername  string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword  string `mapstructure:"SMTP_PASSWORD"`
+
+	RequireEmailVerification  bool          `mapstructure:"REQUIRE_EMAIL_VERIFICATION"`
+	VerificationTokenDuration time.Duration `mapstructure:"VERIFICATION_TOKEN_DURATION"`
+	// VerificationURL is prepended to the token in the verification email, the token alone is sent when empty
+	VerificationURL string `mapstructure:"VERIFICATION_URL"`
+
+	PasswordResetTokenDuration time.Duration `mapstructure:"PASSWORD_RESET_TOKEN_DURATION"`
+	// PasswordResetURL is prepended to the token in the password reset email, the token alone is sent when empty
+	PasswordResetURL string `mapstructure:"PASSWORD_RESET_URL"`
+
+	// MFAIssuer names the service in the authenticator apps of the users
+	MFAIssuer            string        `mapstructure:"MFA_ISSUER"`
+	MFAChallengeDuration time.Duration `mapstructure:"MFA_CHALLENGE_DURATION"`
 }
 
 // LoadConfig reads configuration from file or environment variables.
@@ -24,6 +79,50 @@ func LoadConfig(path string) (config *Config, err error) {
 	viper.SetConfigType("env")
 	viper.AutomaticEnv()
 
+	viper.SetDefault("STORAGE_BACKEND", "local")
+	viper.SetDefault("STORAGE_LOCAL_PATH", "./extracted")
+	viper.SetDefault("S3_ENDPOINT", "")
+	viper.SetDefault("S3_BUCKET", "")
+	viper.SetDefault("S3_REGION", "us-east-1")
+	viper.SetDefault("S3_ACCESS_KEY_ID", "")
+	viper.SetDefault("S3_SECRET_ACCESS_KEY", "")
+	viper.SetDefault("S3_USE_SSL", true)
+	viper.SetDefault("S3_FORCE_PATH_STYLE", false)
+	viper.SetDefault("S3_PART_SIZE", 16*1024*1024)
+	viper.SetDefault("S3_PRESIGN_DOWNLOADS", false)
+	viper.SetDefault("S3_PRESIGN_EXPIRY", "15m")
+	viper.SetDefault("SHARE_LINK_KEY", "")
+	viper.SetDefault("SHARE_LINK_DURATION", "24h")
+	viper.SetDefault("SHARE_LINK_MAX_DURATION", "720h")
+	viper.SetDefault("EXTRACT_MAX_TOTAL_BYTES", 10*1024*1024*1024)
+	viper.SetDefault("EXTRACT_MAX_ENTRY_BYTES", 5*1024*1024*1024)
+	viper.SetDefault("EXTRACT_MAX_ENTRIES", 100000)
+	viper.SetDefault("EXTRACT_MAX_COMPRESSION_RATIO", 200)
+	viper.SetDefault("JOB_WORKERS", 2)
+	viper.SetDefault("JOB_POLL_INTERVAL", "2s")
+	viper.SetDefault("BLOB_GC_INTERVAL", "10m")
+	viper.SetDefault("TRASH_RETENTION", "720h")
+	viper.SetDefault("TRASH_PURGE_INTERVAL", "1h")
+	viper.SetDefault("QUOTA_DEFAULT_MAX_BYTES", 5*1024*1024*1024)
+	viper.SetDefault("QUOTA_DEFAULT_MAX_FILES", 100000)
+	viper.SetDefault("TUS_UPLOAD_PATH", "./uploads")
+	viper.SetDefault("TUS_MAX_SIZE", 10*1024*1024*1024)
+	viper.SetDefault("TUS_UPLOAD_EXPIRY", "24h")
+	viper.SetDefault("MAILER_BACKEND", "log")
+	viper.SetDefault("MAILER_FROM", "noreply@localhost")
+	viper.SetDefault("MAILER_LOG_PATH", "")
+	viper.SetDefault("SMTP_HOST", "")
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("SMTP_USERNAME", "")
+	viper.SetDefault("SMTP_PASSWORD", "")
+	viper.SetDefault("REQUIRE_EMAIL_VERIFICATION", false)
+	viper.SetDefault("VERIFICATION_TOKEN_DURATION", "24h")
+	viper.SetDefault("VERIFICATION_URL", "")
+	viper.SetDefault("PASSWORD_RESET_TOKEN_DURATION", "1h")
+	viper.SetDefault("PASSWORD_RESET_URL", "")
+	viper.SetDefault("MFA_ISSUER", "Filesystem API")
+	viper.SetDefault("MFA_CHALLENGE_DURATION", "5m")
+
 	err = viper.ReadInConfig()
 	if err != nil {
 		return
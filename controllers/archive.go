@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/dbsSensei/filesystem-api/archive"
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/storage"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// findArchiveIndex loads the index of an inspected archive owned by the user
+func (f *FilesystemController) findArchiveIndex(ctx *gin.Context) (*models.Filesystem, *models.ArchiveIndex, bool) {
+	file, ok := f.findOwnedFile(ctx)
+	if !ok {
+		return nil, nil, false
+	}
+
+	index, err := service.FindArchiveIndex(f.db, file.Sha256)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return nil, nil, false
+	}
+	if index == nil {
+		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "file is not an inspected archive", nil))
+		return nil, nil, false
+	}
+
+	return file, index, true
+}
+
+// ArchiveEntries godoc
+// @Summary List the entries of an archive.
+// @Description get the files and directories of an archive uploaded in inspect mode, without extracting it.
+// @Tags Files
+// @Accept */*
+// @Produce json
+// @Param id path int true "file id"
+// @Param prefix query string false "only list the entries whose path starts with prefix"
+// @Success 200 {object} utils.Response{data=forms.ArchiveEntriesResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/entries [get]
+func (f *FilesystemController) ArchiveEntries(ctx *gin.Context) {
+	file, index, ok := f.findArchiveIndex(ctx)
+	if !ok {
+		return
+	}
+
+	query := f.db.Where("sha256 = ?", index.Sha256)
+	if prefix := ctx.Query("prefix"); prefix != "" {
+		query = query.Where("LEFT(path, LENGTH(?)) = ?", prefix, prefix)
+	}
+
+	entries := []models.ArchiveEntry{}
+	if err := query.Order("path").Find(&entries).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get archive entries", forms.ArchiveEntriesResponse{
+		FileID:  file.ID,
+		Format:  index.Format,
+		Entries: entries,
+	}))
+}
+
+// DownloadArchiveEntry godoc
+// @Summary Download a single entry of an archive.
+// @Description streams one regular file of an archive uploaded in inspect mode, without extracting the others.
+// @Tags Files
+// @Accept */*
+// @Produce application/file
+// @Param id path int true "file id"
+// @Param path query string true "path of the entry inside the archive"
+// @Success 200
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/entries/content [get]
+func (f *FilesystemController) DownloadArchiveEntry(ctx *gin.Context) {
+	entryPath := ctx.Query("path")
+	if entryPath == "" {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "path is required", nil))
+		return
+	}
+
+	file, index, ok := f.findArchiveIndex(ctx)
+	if !ok {
+		return
+	}
+
+	var entries []models.ArchiveEntry
+	err := f.db.Where("sha256 = ? AND path = ? AND is_dir = ?", index.Sha256, entryPath, false).Limit(1).Find(&entries).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	if len(entries) == 0 {
+		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", archive.ErrEntryNotFound.Error(), nil))
+		return
+	}
+	entry := entries[0]
+
+	object, err := f.s.Storage.Get(ctx.Request.Context(), file.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "File not found", nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	defer object.Close()
+
+	reader, err := archive.OpenEntry(object, file.Size, archive.Format(index.Format), archive.Entry{
+		Name:   entry.Path,
+		Size:   entry.Size,
+		Offset: entry.Offset,
+	})
+	if err != nil {
+		if errors.Is(err, archive.ErrEntryNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	defer reader.Close()
+
+	name := path.Base(entry.Path)
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	ctx.DataFromReader(http.StatusOK, entry.Size, contentType, reader, map[string]string{
+		"Content-Disposition": utils.ContentDisposition("attachment", name),
+		"Cache-Control":       "private, no-cache",
+	})
+}
@@ -1,8 +1,9 @@
 package controllers
 
 import (
-	"encoding/json"
+	"errors"
 	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"net/http"
 	"strings"
@@ -32,7 +33,7 @@ func NewAuthController(config *config.Config, db *gorm.DB, s *service.Services)
 
 // Signup godoc
 // @Summary Signup user.
-// @Description register user.
+// @Description register user, a token to verify their email address is emailed to them.
 // @Tags Auth
 // @Accept application/json
 // @Param request body forms.SignupRequest true "request body"
@@ -53,11 +54,14 @@ func (ac *AuthController) Signup(ctx *gin.Context) {
 	//	return
 	//}
 
+	var user *models.User
+	var verificationToken string
 	createUserTransaction := func(tx *gorm.DB) error {
 		hashedPassword, _ := utils.HashPassword(input.Password)
 		input.Password = hashedPassword
 
-		_, err := ac.s.UserService.Create(&models.User{
+		var err error
+		user, err = ac.s.UserService.Create(&models.User{
 			Name:     input.Name,
 			Email:    input.Email,
 			Password: input.Password,
@@ -67,7 +71,8 @@ func (ac *AuthController) Signup(ctx *gin.Context) {
 			return err
 		}
 
-		return nil
+		verificationToken, err = service.IssueActionToken(tx, user.ID, models.ActionTokenVerifyEmail, ac.c.VerificationTokenDuration)
+		return err
 	}
 
 	if err := utils.Transaction(database.GetDB(), createUserTransaction); err != nil {
@@ -78,25 +83,26 @@ func (ac *AuthController) Signup(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
 		return
 	}
+	ac.sendVerificationEmail(user, verificationToken)
 
 	ctx.JSON(http.StatusCreated, utils.ResponseData("success", "success create user", nil))
 }
 
 // Signin godoc
 // @Summary Login user.
-// @Description login user with credentials.
+// @Description login user with credentials. When the user enabled two-factor authentication, a challenge is returned instead of the tokens, which are issued by signin mfa. No challenge is returned while the user is locked out after too many wrong codes.
 // @Tags Auth
 // @Accept application/json
 // @Param request body forms.SigninRequest true "request body"
 // @Produce json
-// @Success 200 {object} utils.Response{data=forms.SigninResponse}
+// @Success 200 {object} utils.Response{data=forms.MFAChallengeResponse}
+// @Success 201 {object} utils.Response{data=forms.SigninResponse}
 // @Failure 400 {object} utils.Response{data=object}
+// @Failure 403 {object} utils.Response{data=object}
+// @Failure 429 {object} utils.Response{data=object}
 // @Failure 500 {object} utils.Response{data=object}
 // @Router /api/v1/auth/signin [post]
 func (ac *AuthController) Signin(c *gin.Context) {
-	cfg, _ := config.LoadConfig(".")
-	tokenMaker, _ := utils.NewJWTMaker(cfg.TokenSymmetricKey)
-
 	var input forms.SigninRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
@@ -104,75 +110,212 @@ func (ac *AuthController) Signin(c *gin.Context) {
 	}
 
 	findUserWithEmailQuery := func(query *gorm.DB) *gorm.DB {
-		pageNum := 1
-		pageSize := 1
-		query.Where("LOWER(email) = ?", strings.ToLower(input.Email))
-		query = query.Limit(pageSize).Offset((pageNum - 1) * pageSize)
-		return query
+		return query.Where("LOWER(email) = ?", strings.ToLower(input.Email)).Limit(1)
 	}
 
-	results, err := ac.s.UserService.FindAll(findUserWithEmailQuery, nil)
+	users, err := ac.s.UserService.FindAll(findUserWithEmailQuery, nil)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
 		return
 	}
 
-	result, err := json.Marshal(results[0])
-	if err != nil {
+	if len(users) == 0 {
+		c.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid email or password", nil))
 		return
 	}
+	user := users[0]
 
-	var user models.User
-	err = json.Unmarshal(result, &user)
+	err = utils.CheckPassword(input.Password, user.Password)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid email or password", nil))
 		return
 	}
 
-	if user.ID == 0 {
-		c.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid email or password", nil))
+	// Checked after the password so the status of an account is not disclosed
+	if ac.c.RequireEmailVerification && user.Status == models.UserStatusPending {
+		c.JSON(http.StatusForbidden, utils.ResponseData("error", "please verify your email", nil))
 		return
 	}
 
-	//if user.Status == models.UserStatusPending {
-	//	c.JSON(http.StatusBadRequest, utils.ResponseData("error", "please verify your account", nil))
-	//	return
-	//}
+	// The tokens are only issued once a code of the second factor is confirmed
+	if user.TOTPEnabled {
+		// No challenge is issued while the user is locked out, so signing in again does
+		// not allow more guesses
+		if service.MFALockedOut(&user, time.Now()) {
+			c.JSON(http.StatusTooManyRequests, utils.ResponseData("error", service.ErrMFALockedOut.Error(), nil))
+			return
+		}
 
-	err = utils.CheckPassword(input.Password, user.Password)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid email or password", nil))
+		var challenge forms.MFAChallengeResponse
+		challengeTransaction := func(tx *gorm.DB) error {
+			challenge.ExpiresAt = time.Now().Add(ac.c.MFAChallengeDuration)
+			token, err := service.IssueActionToken(tx, user.ID, models.ActionTokenMFAChallenge, ac.c.MFAChallengeDuration)
+			challenge.MFARequired, challenge.MFAToken = true, token
+			return err
+		}
+
+		if err := utils.Transaction(ac.db, challengeTransaction); err != nil {
+			c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+
+		c.JSON(http.StatusOK, utils.ResponseData("success", "two-factor authentication required", challenge))
+		return
+	}
+
+	var rsp forms.SigninResponse
+	signinTransaction := func(tx *gorm.DB) error {
+		var err error
+		rsp, err = ac.issueTokens(c, tx, user.ID, uuid.New())
+		return err
+	}
+
+	if err := utils.Transaction(ac.db, signinTransaction); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
 		return
 	}
 
-	accessToken, accessPayload, _ := tokenMaker.CreateToken(
-		user.ID,
-		cfg.AccessTokenDuration,
-	)
+	c.JSON(http.StatusCreated, utils.ResponseData("success", "success signin user", rsp))
+}
+
+// issueTokens creates an access and refresh token pair for a session of the user,
+// storing the refresh token so it can be exchanged once
+func (ac *AuthController) issueTokens(c *gin.Context, tx *gorm.DB, userID int, sessionID uuid.UUID) (forms.SigninResponse, error) {
+	tokenMaker, err := utils.NewJWTMaker(ac.c.TokenSymmetricKey)
+	if err != nil {
+		return forms.SigninResponse{}, err
+	}
 
-	refreshToken, refreshPayload, err := tokenMaker.CreateToken(
-		user.ID,
-		cfg.RefreshTokenDuration,
-	)
+	accessToken, accessPayload, err := tokenMaker.CreateToken(userID, sessionID, utils.TokenTypeAccess, ac.c.AccessTokenDuration)
+	if err != nil {
+		return forms.SigninResponse{}, err
+	}
+
+	refreshToken, refreshPayload, err := tokenMaker.CreateToken(userID, sessionID, utils.TokenTypeRefresh, ac.c.RefreshTokenDuration)
+	if err != nil {
+		return forms.SigninResponse{}, err
+	}
 
 	_, err = ac.s.TokenService.Create(&models.Token{
 		ID:           refreshPayload.Id,
-		UserID:       user.ID,
+		UserID:       userID,
+		SessionID:    sessionID,
 		RefreshToken: refreshToken,
+		ClientIP:     c.ClientIP(),
+		UserAgent:    truncate(c.Request.UserAgent(), 512),
 		IsBlocked:    false,
-		ExpiresAt:    time.Time{},
-		CreatedAt:    time.Time{},
-		UpdatedAt:    time.Time{},
-	}, nil)
+		ExpiresAt:    refreshPayload.ExpiredAt,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}, tx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return forms.SigninResponse{}, err
 	}
 
-	rsp := forms.SigninResponse{
-		SessionID:             refreshPayload.Id,
+	return forms.SigninResponse{
+		SessionID:             sessionID,
 		AccessToken:           accessToken,
 		AccessTokenExpiresAt:  accessPayload.ExpiredAt,
 		RefreshToken:          refreshToken,
 		RefreshTokenExpiresAt: refreshPayload.ExpiredAt,
+	}, nil
+}
+
+// Refresh godoc
+// @Summary Refresh the tokens of a session.
+// @Description exchange a refresh token for a new access and refresh token pair. Each refresh token can only be exchanged once, replaying one that was already exchanged revokes the whole session.
+// @Tags Auth
+// @Accept application/json
+// @Param request body forms.RefreshTokenRequest true "request body"
+// @Produce json
+// @Success 200 {object} utils.Response{data=forms.SigninResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 401 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Router /api/v1/auth/refresh [post]
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var input forms.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
 	}
 
-	c.JSON(http.StatusCreated, utils.ResponseData("success", "success signin user", rsp))
+	tokenMaker, err := utils.NewJWTMaker(ac.c.TokenSymmetricKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	payload, err := tokenMaker.VerifyToken(input.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	// Access tokens share the signing key but can not be exchanged
+	if payload.Type != utils.TokenTypeRefresh {
+		c.JSON(http.StatusUnauthorized, utils.ResponseData("error", utils.ErrInvalidToken.Error(), nil))
+		return
+	}
+
+	var rsp forms.SigninResponse
+	reused := false
+	refreshTransaction := func(tx *gorm.DB) error {
+		token, err := service.RotateRefreshToken(tx, payload, input.RefreshToken)
+		if errors.Is(err, service.ErrRefreshTokenReused) {
+			// Commit the revocation of the session
+			reused = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rsp, err = ac.issueTokens(c, tx, token.UserID, token.SessionID)
+		return err
+	}
+
+	if err := utils.Transaction(ac.db, refreshTransaction); err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	if reused {
+		c.JSON(http.StatusUnauthorized, utils.ResponseData("error", service.ErrRefreshTokenReused.Error(), nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.ResponseData("success", "success refresh tokens", rsp))
+}
+
+// truncate shortens value to at most n bytes without splitting a UTF-8 sequence
+func truncate(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	return strings.ToValidUTF8(value[:n], "")
+}
+
+// Logout godoc
+// @Summary Logout user.
+// @Description revoke the current session, its refresh and access tokens stop working.
+// @Tags Auth
+// @Accept */*
+// @Produce json
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/auth/logout [post]
+func (ac *AuthController) Logout(c *gin.Context) {
+	authPayload := c.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	if err := service.RevokeSession(ac.db, authPayload.SessionId); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.ResponseData("success", "success logout user", nil))
 }
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/archive"
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/storage"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// bundleEntry is a file of a bundle with its path inside the archive
+type bundleEntry struct {
+	file *models.Filesystem
+	name string
+	size int64
+}
+
+// bundleDir is a folder of a bundle with its path inside the archive
+type bundleDir struct {
+	name    string
+	modTime time.Time
+}
+
+// folderTree holds the folders of a user to resolve the paths of their files
+type folderTree map[int]models.Folder
+
+// path returns the slash separated path of a folder, relative to the folder stop
+// (excluded) or to the root when stop is nil
+func (t folderTree) path(folderID *int, stop *int) string {
+	var names []string
+	for id := folderID; id != nil; {
+		if stop != nil && *id == *stop {
+			break
+		}
+		folder, ok := t[*id]
+		if !ok || len(names) > len(t) {
+			break
+		}
+		names = append([]string{folder.Name}, names...)
+		id = folder.ParentID
+	}
+	return path.Join(names...)
+}
+
+// subtree returns the id of folderID and of every folder below it
+func (t folderTree) subtree(folderID int) []int {
+	children := make(map[int][]int)
+	for _, folder := range t {
+		if folder.ParentID != nil {
+			children[*folder.ParentID] = append(children[*folder.ParentID], folder.ID)
+		}
+	}
+
+	ids := []int{folderID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids
+}
+
+// DownloadBundle godoc
+// @Summary Download several files as an archive.
+// @Description streams a zip or tar.gz archive of files or of a folder of the logged-in user, keeping their relative paths. Every file must be owned by the user.
+// @Tags Files
+// @Accept json
+// @Produce application/zip
+// @Produce application/gzip
+// @Param request body forms.DownloadBundleRequest true "file ids or a folder id, and the archive format: zip (default) or tar.gz"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/download/bundle [post]
+func (f *FilesystemController) DownloadBundle(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	var input forms.DownloadBundleRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	if len(input.FileIDs) == 0 && input.FolderID == nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "file_ids or folder_id is required", nil))
+		return
+	}
+
+	format := archive.FormatZip
+	if input.Format != "" {
+		format = archive.Format(input.Format)
+	}
+
+	var folders []models.Folder
+	if err := f.db.Where("user_id = ?", authPayload.UserId).Find(&folders).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	tree := make(folderTree)
+	for _, folder := range folders {
+		tree[folder.ID] = folder
+	}
+
+	var files []models.Filesystem
+	var dirs []bundleDir
+	bundleName := "files"
+	var relativeTo *int
+
+	if len(input.FileIDs) > 0 {
+		ids := make(map[int]bool)
+		for _, id := range input.FileIDs {
+			ids[id] = true
+		}
+
+		if err := f.db.Where("user_id = ? AND id IN ?", authPayload.UserId, input.FileIDs).Find(&files).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		if len(files) != len(ids) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "File not found", nil))
+			return
+		}
+	} else {
+		folder, ok := tree[*input.FolderID]
+		if !ok {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", errFolderNotFound.Error(), nil))
+			return
+		}
+		bundleName = folder.Name
+		relativeTo = folder.ParentID
+
+		folderIDs := tree.subtree(folder.ID)
+		for i := range folderIDs {
+			dirs = append(dirs, bundleDir{
+				name:    tree.path(&folderIDs[i], relativeTo),
+				modTime: tree[folderIDs[i]].UpdatedAt,
+			})
+		}
+
+		if err := f.db.Where("user_id = ? AND folder_id IN ?", authPayload.UserId, folderIDs).Order("id").Find(&files).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+	}
+
+	// Check every content before the response starts, errors can not be reported afterwards
+	entries := make([]bundleEntry, 0, len(files))
+	taken := make(map[string]bool)
+	for _, dir := range dirs {
+		taken[dir.name] = true
+	}
+	for i := range files {
+		file := &files[i]
+
+		info, err := f.s.Storage.Stat(ctx.Request.Context(), file.StorageKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "File not found", nil))
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+
+		// Several files can end up with the same path, such as files picked from
+		// folders that were since renamed to the same name
+		dir := tree.path(file.FolderID, relativeTo)
+		name := path.Join(dir, file.Name)
+		for n := 1; taken[name]; n++ {
+			name = path.Join(dir, service.SuffixedName(file.Name, n))
+		}
+		taken[name] = true
+
+		entries = append(entries, bundleEntry{file: file, name: name, size: info.Size})
+	}
+
+	contentType := "application/zip"
+	if format == archive.FormatTarGz {
+		contentType = "application/gzip"
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", utils.ContentDisposition("attachment", bundleName+"."+string(format)))
+	ctx.Status(http.StatusOK)
+
+	writer, err := archive.NewWriter(format, ctx.Writer)
+	if err != nil {
+		log.Printf("failed to create bundle: %v", err)
+		return
+	}
+
+	for _, dir := range dirs {
+		if err := writer.WriteDir(dir.name, dir.modTime); err != nil {
+			log.Printf("failed to write bundle: %v", err)
+			return
+		}
+	}
+
+	for _, entry := range entries {
+		if err := f.writeBundleEntry(ctx, writer, entry); err != nil {
+			// The archive is left truncated so the client sees it is broken
+			log.Printf("failed to write %s to bundle: %v", entry.name, err)
+			return
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Printf("failed to write bundle: %v", err)
+	}
+}
+
+// writeBundleEntry streams the content of a file into the bundle
+func (f *FilesystemController) writeBundleEntry(ctx *gin.Context, writer archive.Writer, entry bundleEntry) error {
+	reader, err := f.s.Storage.Get(ctx.Request.Context(), entry.file.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	mode := fs.FileMode(0644)
+	if entry.file.Mode != nil {
+		mode = fs.FileMode(*entry.file.Mode).Perm()
+	}
+	modTime := entry.file.UpdatedAt
+	if entry.file.ModTime != nil {
+		modTime = *entry.file.ModTime
+	}
+
+	return writer.WriteFile(entry.name, entry.size, mode, modTime, reader)
+}
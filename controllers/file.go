@@ -0,0 +1,342 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/storage"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// fileErrorResponse writes the error of a file operation
+func fileErrorResponse(ctx *gin.Context, err error) {
+	err = service.FileNameError(err)
+	switch {
+	case errors.Is(err, errFileNotFound), errors.Is(err, errFolderNotFound):
+		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", err.Error(), nil))
+	case errors.Is(err, service.ErrFileExists):
+		ctx.JSON(http.StatusConflict, utils.ResponseData("error", err.Error(), nil))
+	case errors.Is(err, service.ErrQuotaExceeded):
+		ctx.JSON(http.StatusRequestEntityTooLarge, utils.ResponseData("error", err.Error(), nil))
+	default:
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+	}
+}
+
+// conflictPolicy returns the policy requested with on_conflict, fail by default
+func conflictPolicy(onConflict string) service.ConflictPolicy {
+	if onConflict == "" {
+		return service.ConflictFail
+	}
+	return service.ConflictPolicy(onConflict)
+}
+
+// parseFileID parses the id path param, writing a 400 response when it is invalid
+func parseFileID(ctx *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid file id", nil))
+		return 0, false
+	}
+	return id, true
+}
+
+// RenameFile godoc
+// @Summary Rename a file.
+// @Description rename a file of the logged-in user, on_conflict decides what happens when the folder already holds a file with the new name.
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param id path int true "file id"
+// @Param request body forms.RenameFileRequest true "new name and conflict policy: fail (default), overwrite or auto_suffix"
+// @Success 200 {object} utils.Response{data=models.Filesystem}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 409 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/rename [patch]
+func (f *FilesystemController) RenameFile(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, ok := parseFileID(ctx)
+	if !ok {
+		return
+	}
+
+	var input forms.RenameFileRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	if !validEntryName(input.Name) {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid file name", nil))
+		return
+	}
+
+	var file *models.Filesystem
+	renameFileTransaction := func(tx *gorm.DB) error {
+		var err error
+		file, err = lockUserFile(tx, authPayload.UserId, id)
+		if err != nil {
+			return err
+		}
+
+		name, err := service.ResolveNameConflict(tx, authPayload.UserId, file.FolderID, input.Name, conflictPolicy(input.OnConflict), file.ID)
+		if err != nil {
+			return err
+		}
+
+		file.Name = name
+		_, err = f.s.FilesystemService.Update(file.ID, file, tx)
+		return err
+	}
+
+	if err := utils.Transaction(f.db, renameFileTransaction); err != nil {
+		fileErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success rename file", file))
+}
+
+// MoveFile godoc
+// @Summary Move a file.
+// @Description move a file of the logged-in user to another folder, on_conflict decides what happens when the folder already holds a file with the same name.
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param id path int true "file id"
+// @Param request body forms.MoveFileRequest true "destination folder, null for the root, and conflict policy: fail (default), overwrite or auto_suffix"
+// @Success 200 {object} utils.Response{data=models.Filesystem}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 409 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/move [patch]
+func (f *FilesystemController) MoveFile(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, ok := parseFileID(ctx)
+	if !ok {
+		return
+	}
+
+	var input forms.MoveFileRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	var file *models.Filesystem
+	moveFileTransaction := func(tx *gorm.DB) error {
+		var err error
+		file, err = lockUserFile(tx, authPayload.UserId, id)
+		if err != nil {
+			return err
+		}
+
+		if input.FolderID != nil {
+			if _, err := findUserFolder(tx, authPayload.UserId, *input.FolderID); err != nil {
+				return err
+			}
+		}
+
+		name, err := service.ResolveNameConflict(tx, authPayload.UserId, input.FolderID, file.Name, conflictPolicy(input.OnConflict), file.ID)
+		if err != nil {
+			return err
+		}
+
+		file.Name = name
+		file.FolderID = input.FolderID
+		_, err = f.s.FilesystemService.Update(file.ID, file, tx)
+		return err
+	}
+
+	if err := utils.Transaction(f.db, moveFileTransaction); err != nil {
+		fileErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success move file", file))
+}
+
+// CopyFile godoc
+// @Summary Copy a file.
+// @Description copy the current version of a file of the logged-in user to a folder without uploading it again, on_conflict decides what happens when the folder already holds a file with the same name.
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param id path int true "file id"
+// @Param request body forms.CopyFileRequest true "destination folder, null for the root, name of the copy and conflict policy: fail (default), overwrite or auto_suffix"
+// @Success 201 {object} utils.Response{data=models.Filesystem}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 409 {object} utils.Response{data=object}
+// @Failure 413 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/copy [post]
+func (f *FilesystemController) CopyFile(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, ok := parseFileID(ctx)
+	if !ok {
+		return
+	}
+
+	var input forms.CopyFileRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	if input.Name != "" && !validEntryName(input.Name) {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid file name", nil))
+		return
+	}
+
+	user, err := f.s.UserService.FindOne(authPayload.UserId, nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	quota := service.UserQuota(f.config, user)
+
+	var copied *models.Filesystem
+	var copiedKey string
+	copyFileTransaction := func(tx *gorm.DB) error {
+		file, err := lockUserFile(tx, authPayload.UserId, id)
+		if err != nil {
+			return err
+		}
+
+		if input.FolderID != nil {
+			if _, err := findUserFolder(tx, authPayload.UserId, *input.FolderID); err != nil {
+				return err
+			}
+		}
+
+		name := input.Name
+		if name == "" {
+			name = file.Name
+		}
+		name, err = service.ResolveNameConflict(tx, authPayload.UserId, input.FolderID, name, conflictPolicy(input.OnConflict), 0)
+		if err != nil {
+			return err
+		}
+
+		if err := service.ChargeUsage(tx, authPayload.UserId, quota, file.Size, 1); err != nil {
+			return err
+		}
+
+		// Contents in blobs are shared, files stored before blobs existed own their
+		// object so it is copied in the storage
+		content := file.FileContent
+		if content.Sha256 != "" {
+			if _, err := service.AcquireBlob(tx, content.Sha256, content.StorageKey, content.Size); err != nil {
+				return err
+			}
+		} else {
+			copiedKey = storage.NewKey("", authPayload.UserId)
+			if err := f.copyObject(ctx.Request.Context(), content.StorageKey, copiedKey); err != nil {
+				copiedKey = ""
+				return err
+			}
+			content.StorageKey = copiedKey
+		}
+
+		copied = &models.Filesystem{
+			UserID:      authPayload.UserId,
+			FolderID:    input.FolderID,
+			Name:        name,
+			Version:     1,
+			FileContent: content,
+		}
+		_, err = f.s.FilesystemService.Create(copied, tx)
+		return err
+	}
+
+	if err := utils.Transaction(f.db, copyFileTransaction); err != nil {
+		if copiedKey != "" {
+			_ = f.s.Storage.Delete(context.Background(), copiedKey)
+		}
+		fileErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, utils.ResponseData("success", "success copy file", copied))
+}
+
+// copyObject copies the object stored under key to a new key of the storage
+func (f *FilesystemController) copyObject(ctx context.Context, key string, newKey string) error {
+	info, err := f.s.Storage.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	reader, err := f.s.Storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return f.s.Storage.Put(ctx, newKey, reader, info.Size)
+}
+
+// SetFileTags godoc
+// @Summary Set the tags of a file.
+// @Description replace the tags of a file of the logged-in user, my-files can be filtered on them.
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param id path int true "file id"
+// @Param request body forms.SetFileTagsRequest true "tags of the file, an empty list removes them all"
+// @Success 200 {object} utils.Response{data=forms.FileTagsResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/tags [put]
+func (f *FilesystemController) SetFileTags(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, ok := parseFileID(ctx)
+	if !ok {
+		return
+	}
+
+	var input forms.SetFileTagsRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	var tags []string
+	setFileTagsTransaction := func(tx *gorm.DB) error {
+		file, err := lockUserFile(tx, authPayload.UserId, id)
+		if err != nil {
+			return err
+		}
+
+		tags, err = service.SetFileTags(tx, file.ID, input.Tags)
+		return err
+	}
+
+	if err := utils.Transaction(f.db, setFileTagsTransaction); err != nil {
+		fileErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success set file tags", forms.FileTagsResponse{
+		FileID: id,
+		Tags:   tags,
+	}))
+}
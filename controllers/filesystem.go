@@ -1,23 +1,18 @@
 package controllers
 
 import (
-	"archive/tar"
-	"compress/gzip"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"github.com/dbsSensei/filesystem-api/config"
 	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/jobs"
 	"github.com/dbsSensei/filesystem-api/models"
 	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/storage"
 	"github.com/dbsSensei/filesystem-api/utils"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
-	"time"
 )
 
 type FilesystemController struct {
@@ -35,250 +30,396 @@ func NewFilesystemController(config *config.Config, db *gorm.DB, s *service.Serv
 }
 
 // Download godoc
-// @Summary Download a compressed file
-// @Description Downloads a tar.gz file for processing
+// @Summary Download a file
+// @Description Downloads a file owned by the logged-in user. Supports single and multiple byte ranges and conditional requests on the ETag and Last-Modified headers.
 // @Tags Files
 // @Accept */*
 // @Produce application/file
 // @Success 200 {object} utils.Response
+// @Success 206 {object} utils.Response "the requested byte ranges"
+// @Success 304 {object} utils.Response "not modified"
+// @Success 307 {object} utils.Response "redirect to a presigned storage URL"
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
 // @Failure 500 {object} utils.Response{data=object}
-// @Param filename path string true "file you want to download"
-// @Router /api/v1/filesystem/download/{filename} [get]
+// @Security ApiKeyAuth
+// @Param id path int true "id of the file you want to download"
+// @Param Range header string false "byte ranges, e.g. bytes=0-1023"
+// @Param If-None-Match header string false "ETag of a cached copy"
+// @Param If-Modified-Since header string false "Last-Modified of a cached copy"
+// @Param If-Range header string false "ETag or Last-Modified the Range applies to"
+// @Failure 416 {object} utils.Response "range not satisfiable"
+// @Router /api/v1/filesystem/download/{id} [get]
 func (f *FilesystemController) Download(ctx *gin.Context) {
-	filename := ctx.Param("filename")
-
-	// Check if the file exists in the extracted folder
-	extractedFolder := "./extracted"
-	filePath := filepath.Join(extractedFolder, filename)
-	_, err := os.Stat(filePath)
-	if err != nil {
-		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "File not found", nil))
+	file, ok := f.findOwnedFile(ctx)
+	if !ok {
 		return
 	}
 
-	// Set the appropriate headers for the file download
-	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	ctx.Header("Content-Type", "application/octet-stream")
-	ctx.File(filePath)
+	f.serveFile(ctx, file)
 }
 
-// MyFiles godoc
-// @Summary Show logged-in user files.
-// @Description get all logged-in user files.
+// File godoc
+// @Summary Show a file metadata.
+// @Description get the size, type, checksum and origin of a file owned by the logged-in user.
 // @Tags Files
 // @Accept */*
 // @Produce json
+// @Param id path int true "file id"
 // @Success 200 {object} utils.Response{data=models.Filesystem}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
 // @Failure 500 {object} utils.Response{data=object}
 // @Security ApiKeyAuth
-// @Param page query int false  "files page"
-// @Param limit query int false  "limit per files"
-// @Param order_by query string false  "order files by"
-// @Router /api/v1/filesystem/my-files [get]
-func (ac *UserController) MyFiles(ctx *gin.Context) {
+// @Router /api/v1/filesystem/files/{id} [get]
+func (f *FilesystemController) File(ctx *gin.Context) {
+	file, ok := f.findOwnedFile(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get file", file))
+}
+
+// findOwnedFile loads the file identified by the id path param. Files that do not
+// exist and files owned by another user both respond with 404, so callers cannot
+// probe which ids are in use.
+func (f *FilesystemController) findOwnedFile(ctx *gin.Context) (*models.Filesystem, bool) {
 	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
-	pageNum, _ := strconv.Atoi(ctx.Query("page"))
-	if pageNum == 0 {
-		pageNum = 1
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid file id", nil))
+		return nil, false
 	}
 
-	pageSize, _ := strconv.Atoi(ctx.Query("limit"))
-	if pageSize == 0 {
-		pageSize = 10
+	file, err := f.s.FilesystemService.FindOne(id, nil)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "File not found", nil))
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return nil, false
 	}
 
-	filesFilterAndSort := func(query *gorm.DB) *gorm.DB {
-		query.Where("user_id = ?", authPayload.UserId)
+	if file.UserID != authPayload.UserId {
+		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "File not found", nil))
+		return nil, false
+	}
+
+	return file, true
+}
 
-		queryOrder := ctx.Query("order_by")
-		switch queryOrder {
-		case "newest":
-			query.Order("created_at desc")
-		case "oldest":
-			query.Order("created_at asc")
-		default:
-			query.Order("created_at desc")
+// serveFile streams the stored content of file to the client, or redirects to
+// the storage backend when presigned downloads are enabled
+func (f *FilesystemController) serveFile(ctx *gin.Context, file *models.Filesystem) {
+	// Check if the file exists in the storage
+	if _, err := f.s.Storage.Stat(ctx.Request.Context(), file.StorageKey); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "File not found", nil))
+			return
 		}
-		return query
-	}
-	results, pagination, err := ac.s.FilesystemService.FindAll(pageNum, pageSize, filesFilterAndSort, nil)
-	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
 		return
 	}
 
-	var files []models.Filesystem
-	for _, result := range results {
-		var file models.Filesystem
-		resultJson, err := json.Marshal(result)
+	// Redirect to a presigned URL when the backend can serve the file directly
+	if presigner, ok := f.s.Storage.(storage.Presigner); ok && f.config.S3PresignDownloads {
+		presignedURL, err := presigner.PresignGet(ctx.Request.Context(), file.StorageKey, file.Name, f.config.S3PresignExpiry)
 		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
 			return
 		}
 
-		err = json.Unmarshal(resultJson, &file)
-		if err != nil {
+		ctx.Redirect(http.StatusTemporaryRedirect, presignedURL.String())
+		return
+	}
+
+	f.streamFile(ctx, file)
+}
+
+// streamFile streams the stored content of file to the client through the server
+func (f *FilesystemController) streamFile(ctx *gin.Context, file *models.Filesystem) {
+	reader, err := f.s.Storage.Get(ctx.Request.Context(), file.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "File not found", nil))
 			return
 		}
-		files = append(files, file)
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	defer reader.Close()
+
+	// ServeContent answers the conditional and range requests from the ETag and Last-Modified.
+	// Files stored before content hashes were recorded have no ETag until the pool hashes them.
+	if file.Sha256 != "" {
+		ctx.Header("ETag", utils.StrongETag(file.Sha256))
 	}
-	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get current user files", forms.GetMyFilesResponse{
-		Files:      files,
-		Pagination: pagination,
-	}))
+	contentType := file.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", utils.ContentDisposition("attachment", file.Name))
+	ctx.Header("Cache-Control", "private, no-cache")
+	http.ServeContent(ctx.Writer, ctx.Request, file.Name, file.UpdatedAt, reader)
 }
 
-// Upload godoc
-// @Summary Upload a compressed file
-// @Description Uploads a tar.gz file for processing
+// MyFiles godoc
+// @Summary Show logged-in user files.
+// @Description get the files of the logged-in user outside the trash, filtered and sorted. Offset pagination returns page counts, cursor pagination returns a next_cursor to pass back as cursor and stays stable while files are added.
 // @Tags Files
-// @Accept multipart/form-data
-// @Produce application/json
-// @Param file formData file true "The tar.gz file to upload"
-// @Success 200 {object} utils.Response
+// @Accept */*
+// @Produce json
+// @Param name query string false "match file names, case-insensitive"
+// @Param name_match query string false "how name matches: contains (default) or prefix"
+// @Param mime_type query string false "exact MIME type, or a type followed by /* such as image/*"
+// @Param min_size query int false "minimum size in bytes"
+// @Param max_size query int false "maximum size in bytes"
+// @Param created_after query string false "RFC 3339 time, inclusive"
+// @Param created_before query string false "RFC 3339 time, exclusive"
+// @Param folder_id query string false "folder id, or root for the files outside any folder"
+// @Param tag query []string false "tags the files must all have" collectionFormat(multi)
+// @Param sort query string false "name, size or created_at (default)"
+// @Param order query string false "asc or desc (default)"
+// @Param order_by query string false "newest or oldest, kept for older clients"
+// @Param pagination query string false "offset (default) or cursor"
+// @Param page query int false "files page, offset pagination only"
+// @Param limit query int false "files per page, 10 by default and at most 100"
+// @Param cursor query string false "next_cursor of the previous page, cursor pagination only"
+// @Success 200 {object} utils.Response{data=forms.GetMyFilesResponse}
+// @Failure 400 {object} utils.Response{data=object}
 // @Failure 500 {object} utils.Response{data=object}
 // @Security ApiKeyAuth
-// @Router /api/v1/filesystem/upload [post]
-func (f *FilesystemController) Upload(ctx *gin.Context) {
-	file, err := ctx.FormFile("file")
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "Failed to retrieve the file", nil))
-		return
-	}
+// @Router /api/v1/filesystem/my-files [get]
+func (ac *UserController) MyFiles(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
 
-	// Create a temporary folder to extract the file contents
-	tempFolder := "./temp"
-	if err := os.MkdirAll(tempFolder, os.ModePerm); err != nil {
-		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", "Failed to create temporary folder", nil))
+	var input forms.GetMyFilesRequest
+	if err := ctx.ShouldBindQuery(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
 		return
 	}
-
-	// Save the uploaded file to the temporary folder
-	filePath := filepath.Join(tempFolder, file.Filename)
-	if err := ctx.SaveUploadedFile(file, filePath); err != nil {
-		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", "Failed to save the file", nil))
-		return
+	if input.Page == 0 {
+		input.Page = 1
+	}
+	if input.Limit == 0 {
+		input.Limit = 10
 	}
 
-	// Extract the file contents
-	extractedFolder := "./extracted"
-	if err := extractFile(ctx, f.s, filePath, extractedFolder); err != nil {
-		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", "Failed to extract the file", nil))
-		return
+	filter := service.FileFilter{
+		UserID:        authPayload.UserId,
+		Name:          input.Name,
+		NameMatch:     input.NameMatch,
+		MimeType:      input.MimeType,
+		MinSize:       input.MinSize,
+		MaxSize:       input.MaxSize,
+		CreatedAfter:  input.CreatedAfter,
+		CreatedBefore: input.CreatedBefore,
+		Tags:          input.Tags,
+	}
+	switch input.FolderID {
+	case "":
+	case "root":
+		filter.Root = true
+	default:
+		folderID, err := strconv.Atoi(input.FolderID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid folder id", nil))
+			return
+		}
+		filter.FolderID = &folderID
 	}
 
-	// Read the contents of the extracted files
-	fileContents, err := readExtractedFiles(extractedFolder)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", "Failed to read the extracted files", nil))
-		return
+	sort, desc := service.FileSortCreatedAt, true
+	if input.OrderBy == "oldest" {
+		desc = false
+	}
+	if input.Sort != "" {
+		sort = service.FileSort(input.Sort)
+	}
+	if input.Order != "" {
+		desc = input.Order == "desc"
 	}
 
-	// Clean up the temporary and extracted folders
-	os.RemoveAll(tempFolder)
-	//os.RemoveAll(extractedFolder)
+	var response forms.GetMyFilesResponse
+	var files []models.Filesystem
 
-	ctx.JSON(http.StatusOK, utils.ResponseData("success", "Success extract and upload files", map[string]any{"uploaded_file": fileContents}))
-}
+	if input.Pagination == "cursor" || input.Cursor != "" {
+		var cursor *service.FileCursor
+		if input.Cursor != "" {
+			var err error
+			cursor, err = service.DecodeFileCursor(input.Cursor, sort, desc)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+				return
+			}
+		}
 
-func extractFile(ctx *gin.Context, s *service.Services, filePath, targetFolder string) error {
-	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+		// Fetch one more file to know whether another page follows
+		query := service.OrderFiles(filter.Apply(ac.db.Model(&models.Filesystem{})), sort, desc, cursor)
+		if err := query.Limit(input.Limit + 1).Find(&files).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		if len(files) > input.Limit {
+			files = files[:input.Limit]
+			response.NextCursor = service.NewFileCursor(sort, desc, &files[len(files)-1]).Encode()
+		}
+	} else {
+		orderFiles := func(query *gorm.DB) *gorm.DB {
+			return service.OrderFiles(query, sort, desc, nil)
+		}
 
-	// Open the compressed file for reading
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
+		var pagination utils.Pagination
+		var err error
+		files, pagination, err = ac.s.FilesystemService.FindPage(input.Page, input.Limit, filter.Apply, orderFiles, nil)
+		if errors.Is(err, service.ErrInvalidPage) {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		response.Pagination = &pagination
 	}
-	defer file.Close()
 
-	// Create a gzip reader to read the compressed file
-	gzipReader, err := gzip.NewReader(file)
+	ids := make([]int, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, file.ID)
+	}
+	tags, err := service.FileTags(ac.db, ids)
 	if err != nil {
-		return err
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
 	}
-	defer gzipReader.Close()
 
-	// Create a tar reader to read the contents of the compressed file
-	tarReader := tar.NewReader(gzipReader)
-
-	// Iterate over each file in the tar archive
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			// End of archive
-			break
-		}
-		if err != nil {
-			return err
+	response.Files = make([]forms.MyFile, 0, len(files))
+	for _, file := range files {
+		fileTags := tags[file.ID]
+		if fileTags == nil {
+			fileTags = []string{}
 		}
+		response.Files = append(response.Files, forms.MyFile{Filesystem: file, Tags: fileTags})
+	}
 
-		// Ensure the file is a regular file (not a directory or symbolic link)
-		if header.Typeflag != tar.TypeReg {
-			continue
-		}
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get current user files", response))
+}
 
-		filename := fmt.Sprintf("%v-%v-%v", authPayload.UserId, time.Now().UnixMilli(), header.Name)
+// Upload godoc
+// @Summary Upload a file
+// @Description Uploads a zip, tar, tar.gz, tar.bz2, tar.xz or tar.zst archive and queues its extraction, any other file is stored as it is. Poll the returned job for the outcome.
+// @Tags Files
+// @Accept multipart/form-data
+// @Produce application/json
+// @Param file formData file true "The archive or file to upload"
+// @Param extract formData bool false "set to false to store an archive as a single file instead of extracting it"
+// @Param inspect formData bool false "set to true to store an archive as a single file and index its entries so they can be browsed"
+// @Success 202 {object} utils.Response{data=models.ExtractionJob}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 413 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/upload [post]
+func (f *FilesystemController) Upload(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
 
-		// Extract the file to the target folder
-		filePath := filepath.Join(targetFolder, filename)
-		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
-			return err
-		}
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "Failed to retrieve the file", nil))
+		return
+	}
 
-		file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+	extract := true
+	if value := ctx.PostForm("extract"); value != "" {
+		extract, err = strconv.ParseBool(value)
 		if err != nil {
-			return err
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid extract value", nil))
+			return
 		}
+	}
 
-		if _, err := io.Copy(file, tarReader); err != nil {
-			file.Close()
-			return err
+	inspect := false
+	if value := ctx.PostForm("inspect"); value != "" {
+		inspect, err = strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid inspect value", nil))
+			return
 		}
+	}
 
-		file.Close()
+	uploadedFile, err := file.Open()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", "Failed to open the file", nil))
+		return
+	}
+	defer uploadedFile.Close()
 
-		_, _ = s.FilesystemService.Create(&models.Filesystem{
-			UserID: authPayload.UserId,
-			Name:   filename,
-		}, nil)
+	if !checkUploadQuota(ctx, f.config, f.s, authPayload.UserId, file.Size) {
+		return
+	}
 
+	// Persist the upload so it can be extracted in the background
+	job, err := jobs.Enqueue(ctx.Request.Context(), f.s, authPayload.UserId, file.Filename, uploadedFile, file.Size, extract, inspect)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
 	}
 
-	return nil
+	ctx.JSON(http.StatusAccepted, utils.ResponseData("success", "Success upload file, extraction queued", job))
 }
 
-func readExtractedFiles(extractedFolder string) ([]string, error) {
-	var fileContents []string
-
-	// Traverse the extracted folder and read the contents of each file
-	err := filepath.Walk(extractedFolder, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() {
-			// Read the contents of the file
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+// checkUploadQuota rejects with 413 an upload of size bytes that can not fit in the
+// quota of the user. The extracted files are charged again when they are stored.
+func checkUploadQuota(ctx *gin.Context, c *config.Config, s *service.Services, userID int, size int64) bool {
+	user, err := s.UserService.FindOne(userID, nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return false
+	}
 
-			// TODO handle uploaded
-			_, err = io.ReadAll(file)
-			if err != nil {
-				return err
-			}
+	if err := service.UserQuota(c, user).Check(user, size, 0); err != nil {
+		ctx.JSON(http.StatusRequestEntityTooLarge, utils.ResponseData("error", err.Error(), nil))
+		return false
+	}
+	return true
+}
 
-			// Add the file contents to the result
-			fileContents = append(fileContents, info.Name())
-		}
+// Job godoc
+// @Summary Show an extraction job.
+// @Description get the status and progress of an extraction job of the logged-in user.
+// @Tags Files
+// @Accept */*
+// @Produce json
+// @Param id path int true "job id"
+// @Success 200 {object} utils.Response{data=models.ExtractionJob}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/jobs/{id} [get]
+func (f *FilesystemController) Job(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
 
-		return nil
-	})
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid job id", nil))
+		return
+	}
 
+	var job models.ExtractionJob
+	err = f.db.Where("id = ? AND user_id = ?", id, authPayload.UserId).First(&job).Error
 	if err != nil {
-		return nil, err
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "Job not found", nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
 	}
 
-	return fileContents, nil
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get extraction job", job))
 }
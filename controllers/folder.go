@@ -0,0 +1,431 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const rootFolderParam = "root"
+
+var (
+	errFolderNotFound = errors.New("folder not found")
+	errFolderExists   = errors.New("a folder with the same name already exists")
+	errFolderNotEmpty = errors.New("folder is not empty")
+	errFolderCycle    = errors.New("a folder can not be moved into itself")
+)
+
+// validEntryName reports whether name can be used for a folder or a file
+func validEntryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// findUserFolder loads a folder owned by the user
+func findUserFolder(db *gorm.DB, userID int, id int) (*models.Folder, error) {
+	var folder models.Folder
+	err := db.Where("id = ? AND user_id = ?", id, userID).First(&folder).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errFolderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// folderNameTaken reports whether the parent folder already holds a folder named name
+func folderNameTaken(db *gorm.DB, userID int, parentID *int, name string, exceptID int) (bool, error) {
+	var count int64
+	query := db.Model(&models.Folder{}).Where("user_id = ? AND name = ? AND id <> ?", userID, name, exceptID)
+	err := service.WhereParent(query, "parent_id", parentID).Count(&count).Error
+	return count > 0, err
+}
+
+// folderErrorResponse writes the error of a folder operation
+func folderErrorResponse(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errFolderNotFound):
+		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", err.Error(), nil))
+	case errors.Is(err, errFolderExists), errors.Is(err, errFolderNotEmpty):
+		ctx.JSON(http.StatusConflict, utils.ResponseData("error", err.Error(), nil))
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		// A concurrent request took the name after it was checked
+		ctx.JSON(http.StatusConflict, utils.ResponseData("error", errFolderExists.Error(), nil))
+	case errors.Is(err, errFolderCycle):
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+	default:
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+	}
+}
+
+// parseFolderID parses the id path param, "root" refers to the user root
+func parseFolderID(ctx *gin.Context) (*int, bool) {
+	param := ctx.Param("id")
+	if param == rootFolderParam {
+		return nil, true
+	}
+
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid folder id", nil))
+		return nil, false
+	}
+	return &id, true
+}
+
+// FolderChildren godoc
+// @Summary Show folder contents.
+// @Description get the folders and files inside a folder of the logged-in user, use root as id for the top level.
+// @Tags Folders
+// @Accept */*
+// @Produce json
+// @Param id path string true "folder id or root"
+// @Success 200 {object} utils.Response{data=forms.FolderChildrenResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/folders/{id}/children [get]
+func (f *FilesystemController) FolderChildren(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	folderID, ok := parseFolderID(ctx)
+	if !ok {
+		return
+	}
+
+	response := forms.FolderChildrenResponse{
+		Folders: []models.Folder{},
+		Files:   []models.Filesystem{},
+	}
+
+	if folderID != nil {
+		folder, err := findUserFolder(f.db, authPayload.UserId, *folderID)
+		if err != nil {
+			folderErrorResponse(ctx, err)
+			return
+		}
+		response.Folder = folder
+	}
+
+	query := f.db.Where("user_id = ?", authPayload.UserId).Order("name asc")
+	if err := service.WhereParent(query, "parent_id", folderID).Find(&response.Folders).Error; err != nil {
+		folderErrorResponse(ctx, err)
+		return
+	}
+
+	query = f.db.Where("user_id = ?", authPayload.UserId).Order("name asc")
+	if err := service.WhereParent(query, "folder_id", folderID).Find(&response.Files).Error; err != nil {
+		folderErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get folder children", response))
+}
+
+// FolderPath godoc
+// @Summary Show folder breadcrumb.
+// @Description get the folders leading from the root to a folder of the logged-in user.
+// @Tags Folders
+// @Accept */*
+// @Produce json
+// @Param id path int true "folder id"
+// @Success 200 {object} utils.Response{data=[]models.Folder}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/folders/{id}/path [get]
+func (f *FilesystemController) FolderPath(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	folderID, ok := parseFolderID(ctx)
+	if !ok {
+		return
+	}
+
+	breadcrumb := []models.Folder{}
+	for folderID != nil {
+		folder, err := findUserFolder(f.db, authPayload.UserId, *folderID)
+		if err != nil {
+			folderErrorResponse(ctx, err)
+			return
+		}
+
+		breadcrumb = append([]models.Folder{*folder}, breadcrumb...)
+		folderID = folder.ParentID
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get folder path", breadcrumb))
+}
+
+// CreateFolder godoc
+// @Summary Create a folder.
+// @Description create a folder for the logged-in user, without parent_id the folder is created at the root.
+// @Tags Folders
+// @Accept application/json
+// @Produce json
+// @Param request body forms.CreateFolderRequest true "request body"
+// @Success 201 {object} utils.Response{data=models.Folder}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 409 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/folders [post]
+func (f *FilesystemController) CreateFolder(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	var input forms.CreateFolderRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	if !validEntryName(input.Name) {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid folder name", nil))
+		return
+	}
+
+	folder := &models.Folder{
+		UserID:   authPayload.UserId,
+		ParentID: input.ParentID,
+		Name:     input.Name,
+	}
+
+	createFolderTransaction := func(tx *gorm.DB) error {
+		if input.ParentID != nil {
+			if _, err := findUserFolder(tx, authPayload.UserId, *input.ParentID); err != nil {
+				return err
+			}
+		}
+
+		taken, err := folderNameTaken(tx, authPayload.UserId, input.ParentID, input.Name, 0)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errFolderExists
+		}
+
+		_, err = f.s.FolderService.Create(folder, tx)
+		return err
+	}
+
+	if err := utils.Transaction(f.db, createFolderTransaction); err != nil {
+		folderErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, utils.ResponseData("success", "success create folder", folder))
+}
+
+// RenameFolder godoc
+// @Summary Rename a folder.
+// @Description rename a folder of the logged-in user.
+// @Tags Folders
+// @Accept application/json
+// @Produce json
+// @Param id path int true "folder id"
+// @Param request body forms.RenameFolderRequest true "request body"
+// @Success 200 {object} utils.Response{data=models.Folder}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 409 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/folders/{id}/rename [patch]
+func (f *FilesystemController) RenameFolder(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid folder id", nil))
+		return
+	}
+
+	var input forms.RenameFolderRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	if !validEntryName(input.Name) {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid folder name", nil))
+		return
+	}
+
+	var folder *models.Folder
+	renameFolderTransaction := func(tx *gorm.DB) error {
+		folder, err = findUserFolder(tx, authPayload.UserId, id)
+		if err != nil {
+			return err
+		}
+
+		taken, err := folderNameTaken(tx, authPayload.UserId, folder.ParentID, input.Name, folder.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errFolderExists
+		}
+
+		folder.Name = input.Name
+		return tx.Model(folder).Update("name", folder.Name).Error
+	}
+
+	if err := utils.Transaction(f.db, renameFolderTransaction); err != nil {
+		folderErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success rename folder", folder))
+}
+
+// MoveFolder godoc
+// @Summary Move a folder.
+// @Description move a folder of the logged-in user into another folder, a null parent_id moves it to the root.
+// @Tags Folders
+// @Accept application/json
+// @Produce json
+// @Param id path int true "folder id"
+// @Param request body forms.MoveFolderRequest true "request body"
+// @Success 200 {object} utils.Response{data=models.Folder}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 409 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/folders/{id}/move [patch]
+func (f *FilesystemController) MoveFolder(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid folder id", nil))
+		return
+	}
+
+	var input forms.MoveFolderRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	var folder *models.Folder
+	moveFolderTransaction := func(tx *gorm.DB) error {
+		folder, err = findUserFolder(tx, authPayload.UserId, id)
+		if err != nil {
+			return err
+		}
+
+		// Walk up from the new parent to make sure the folder is not moved below itself
+		for ancestorID := input.ParentID; ancestorID != nil; {
+			if *ancestorID == folder.ID {
+				return errFolderCycle
+			}
+
+			ancestor, err := findUserFolder(tx, authPayload.UserId, *ancestorID)
+			if err != nil {
+				return err
+			}
+			ancestorID = ancestor.ParentID
+		}
+
+		taken, err := folderNameTaken(tx, authPayload.UserId, input.ParentID, folder.Name, folder.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errFolderExists
+		}
+
+		folder.ParentID = input.ParentID
+		return tx.Model(folder).Update("parent_id", folder.ParentID).Error
+	}
+
+	if err := utils.Transaction(f.db, moveFolderTransaction); err != nil {
+		folderErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success move folder", folder))
+}
+
+// DeleteFolder godoc
+// @Summary Delete a folder.
+// @Description delete a folder of the logged-in user, non-empty folders are only deleted with recursive=true. The files inside are moved to the trash.
+// @Tags Folders
+// @Accept */*
+// @Produce json
+// @Param id path int true "folder id"
+// @Param recursive query bool false "delete the folder with everything inside it"
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 409 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/folders/{id} [delete]
+func (f *FilesystemController) DeleteFolder(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid folder id", nil))
+		return
+	}
+
+	recursive, _ := strconv.ParseBool(ctx.Query("recursive"))
+
+	deleteFolderTransaction := func(tx *gorm.DB) error {
+		folder, err := findUserFolder(tx, authPayload.UserId, id)
+		if err != nil {
+			return err
+		}
+
+		var folderIDs []int
+		err = tx.Raw(`
+			WITH RECURSIVE tree AS (
+				SELECT id FROM folders WHERE id = ?
+				UNION ALL
+				SELECT folders.id FROM folders JOIN tree ON folders.parent_id = tree.id
+			)
+			SELECT id FROM tree`, folder.ID).Scan(&folderIDs).Error
+		if err != nil {
+			return err
+		}
+
+		var files []models.Filesystem
+		if err := tx.Where("folder_id IN ?", folderIDs).Find(&files).Error; err != nil {
+			return err
+		}
+
+		if !recursive && (len(folderIDs) > 1 || len(files) > 0) {
+			return errFolderNotEmpty
+		}
+
+		// The files go to the trash, they are restored to the root once their folder is gone
+		if len(files) > 0 {
+			if err := tx.Where("folder_id IN ?", folderIDs).Delete(&models.Filesystem{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("id IN ?", folderIDs).Delete(&models.Folder{}).Error
+	}
+
+	if err := utils.Transaction(f.db, deleteFolderTransaction); err != nil {
+		folderErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success delete folder", nil))
+}
@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	errTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	errTOTPNotEnabled  = errors.New("two-factor authentication is not enabled")
+	errTOTPNotEnrolled = errors.New("two-factor authentication enrollment was not started")
+)
+
+// SigninMFA godoc
+// @Summary Complete a two-factor signin.
+// @Description exchange the challenge returned by signin and a TOTP or recovery code for an access and refresh token pair. Each recovery code can only be used once, and the challenge is used up after 5 wrong codes. Every 5 wrong codes in a row, whatever the challenge, lock the user out of two-factor signins for 15 minutes, doubling with each lockout up to a day.
+// @Tags Auth
+// @Accept application/json
+// @Param request body forms.SigninMFARequest true "request body"
+// @Produce json
+// @Success 201 {object} utils.Response{data=forms.SigninResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 401 {object} utils.Response{data=object}
+// @Failure 429 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Router /api/v1/auth/signin/mfa [post]
+func (ac *AuthController) SigninMFA(c *gin.Context) {
+	var input forms.SigninMFARequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	var rsp forms.SigninResponse
+	failed := false
+	signinTransaction := func(tx *gorm.DB) error {
+		challenge, err := service.FindActionToken(tx, models.ActionTokenMFAChallenge, input.MFAToken)
+		if err != nil {
+			return err
+		}
+
+		// Locked so concurrent attempts are counted one after the other
+		user, err := service.LockUser(tx, challenge.UserID)
+		if err != nil {
+			return err
+		}
+
+		err = service.VerifySigninSecondFactor(tx, user, input.Code, time.Now())
+		if errors.Is(err, service.ErrInvalidMFACode) {
+			// Commit the failed attempt
+			failed = true
+			return service.FailActionToken(tx, challenge, service.MaxMFAAttempts)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := service.UseActionToken(tx, challenge); err != nil {
+			return err
+		}
+
+		rsp, err = ac.issueTokens(c, tx, user.ID, uuid.New())
+		return err
+	}
+
+	if err := utils.Transaction(ac.db, signinTransaction); err != nil {
+		if errors.Is(err, service.ErrInvalidActionToken) {
+			c.JSON(http.StatusUnauthorized, utils.ResponseData("error", "challenge is invalid or has expired, please signin again", nil))
+			return
+		}
+		if errors.Is(err, service.ErrMFALockedOut) {
+			c.JSON(http.StatusTooManyRequests, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	if failed {
+		c.JSON(http.StatusUnauthorized, utils.ResponseData("error", service.ErrInvalidMFACode.Error(), nil))
+		return
+	}
+
+	c.JSON(http.StatusCreated, utils.ResponseData("success", "success signin user", rsp))
+}
+
+// EnrollTOTP godoc
+// @Summary Start two-factor enrollment.
+// @Description generate a TOTP secret for the logged-in user, along with its otpauth URI to scan in an authenticator app. Two-factor authentication is enabled once a code is confirmed, enrolling again replaces the secret.
+// @Tags Users
+// @Accept */*
+// @Produce json
+// @Success 200 {object} utils.Response{data=forms.TOTPEnrollmentResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/users/me/totp [post]
+func (ac *UserController) EnrollTOTP(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	var rsp forms.TOTPEnrollmentResponse
+	enrollTransaction := func(tx *gorm.DB) error {
+		user, err := ac.s.UserService.FindOne(authPayload.UserId, tx)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabled {
+			return errTOTPEnabled
+		}
+
+		secret, err := service.StartTOTPEnrollment(tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		rsp = forms.TOTPEnrollmentResponse{
+			Secret: secret,
+			URI:    utils.TOTPURI(ac.c.MFAIssuer, user.Email, secret),
+		}
+		return nil
+	}
+
+	if err := utils.Transaction(ac.db, enrollTransaction); err != nil {
+		if errors.Is(err, errTOTPEnabled) {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success enroll two-factor authentication", rsp))
+}
+
+// ConfirmTOTP godoc
+// @Summary Enable two-factor authentication.
+// @Description confirm a code of the enrolled secret to enable two-factor authentication. The recovery codes are returned once, each of them can sign in instead of a TOTP code once.
+// @Tags Users
+// @Accept application/json
+// @Param request body forms.TOTPCodeRequest true "request body"
+// @Produce json
+// @Success 200 {object} utils.Response{data=forms.RecoveryCodesResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/users/me/totp/confirm [post]
+func (ac *UserController) ConfirmTOTP(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	var input forms.TOTPCodeRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	var codes []string
+	confirmTransaction := func(tx *gorm.DB) error {
+		user, err := ac.s.UserService.FindOne(authPayload.UserId, tx)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabled {
+			return errTOTPEnabled
+		}
+		if user.TOTPSecret == "" {
+			return errTOTPNotEnrolled
+		}
+
+		codes, err = service.EnableTOTP(tx, user, input.Code)
+		return err
+	}
+
+	if err := utils.Transaction(ac.db, confirmTransaction); err != nil {
+		if errors.Is(err, errTOTPEnabled) || errors.Is(err, errTOTPNotEnrolled) || errors.Is(err, service.ErrInvalidMFACode) {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success enable two-factor authentication", forms.RecoveryCodesResponse{RecoveryCodes: codes}))
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes.
+// @Description replace the recovery codes of the logged-in user after confirming a TOTP or recovery code, the previous ones stop working.
+// @Tags Users
+// @Accept application/json
+// @Param request body forms.TOTPCodeRequest true "request body"
+// @Produce json
+// @Success 200 {object} utils.Response{data=forms.RecoveryCodesResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/users/me/totp/recovery-codes [post]
+func (ac *UserController) RegenerateRecoveryCodes(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	var input forms.TOTPCodeRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	var codes []string
+	regenerateTransaction := func(tx *gorm.DB) error {
+		user, err := ac.s.UserService.FindOne(authPayload.UserId, tx)
+		if err != nil {
+			return err
+		}
+		if !user.TOTPEnabled {
+			return errTOTPNotEnabled
+		}
+
+		if err := service.VerifySecondFactor(tx, user, input.Code); err != nil {
+			return err
+		}
+
+		codes, err = service.GenerateRecoveryCodes(tx, user.ID)
+		return err
+	}
+
+	if err := utils.Transaction(ac.db, regenerateTransaction); err != nil {
+		if errors.Is(err, errTOTPNotEnabled) || errors.Is(err, service.ErrInvalidMFACode) {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success regenerate recovery codes", forms.RecoveryCodesResponse{RecoveryCodes: codes}))
+}
+
+// DisableTOTP godoc
+// @Summary Disable two-factor authentication.
+// @Description turn off two-factor authentication of the logged-in user after confirming their password and a TOTP or recovery code. The secret and recovery codes are deleted.
+// @Tags Users
+// @Accept application/json
+// @Param request body forms.DisableTOTPRequest true "request body"
+// @Produce json
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/users/me/totp/disable [post]
+func (ac *UserController) DisableTOTP(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	var input forms.DisableTOTPRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	disableTransaction := func(tx *gorm.DB) error {
+		user, err := ac.s.UserService.FindOne(authPayload.UserId, tx)
+		if err != nil {
+			return err
+		}
+		if !user.TOTPEnabled {
+			return errTOTPNotEnabled
+		}
+
+		if err := utils.CheckPassword(input.Password, user.Password); err != nil {
+			return errInvalidPassword
+		}
+		if err := service.VerifySecondFactor(tx, user, input.Code); err != nil {
+			return err
+		}
+
+		return service.DisableTOTP(tx, user.ID)
+	}
+
+	if err := utils.Transaction(ac.db, disableTransaction); err != nil {
+		if errors.Is(err, errTOTPNotEnabled) || errors.Is(err, errInvalidPassword) || errors.Is(err, service.ErrInvalidMFACode) {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success disable two-factor authentication", nil))
+}
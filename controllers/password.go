@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/mailer"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errInvalidPassword = errors.New("invalid password")
+
+// sendPasswordResetEmail emails the reset token to the user, once the token is committed
+func (ac *AuthController) sendPasswordResetEmail(user *models.User, token string) {
+	body := "Hi " + user.Name + ",\n\n"
+	if ac.c.PasswordResetURL != "" {
+		body += "Open the following link to choose a new password:\n\n" + ac.c.PasswordResetURL + token + "\n\n"
+	} else {
+		body += "Use the following token to choose a new password:\n\n" + token + "\n\n"
+	}
+	body += "It expires in " + ac.c.PasswordResetTokenDuration.String() + ". If you did not ask to reset your password, you can ignore this email.\n"
+
+	ac.sendEmail(user, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body,
+	})
+}
+
+// ForgotPassword godoc
+// @Summary Forgot password.
+// @Description email a token to reset the password of an account, the previous ones stop working. The response does not tell whether the email belongs to an account, and at most one email is sent per minute.
+// @Tags Auth
+// @Accept application/json
+// @Param request body forms.ForgotPasswordRequest true "request body"
+// @Produce json
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Router /api/v1/auth/password/forgot [post]
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var input forms.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	var user *models.User
+	var token string
+	forgotTransaction := func(tx *gorm.DB) error {
+		users, err := ac.s.UserService.FindAll(func(query *gorm.DB) *gorm.DB {
+			return query.Where("LOWER(email) = ?", strings.ToLower(input.Email)).Limit(1)
+		}, tx)
+		if err != nil || len(users) == 0 {
+			return err
+		}
+
+		lastSentAt, err := service.LastActionTokenAt(tx, users[0].ID, models.ActionTokenResetPassword)
+		if err != nil || time.Since(lastSentAt) < actionEmailInterval {
+			return err
+		}
+
+		user = &users[0]
+		token, err = service.IssueActionToken(tx, user.ID, models.ActionTokenResetPassword, ac.c.PasswordResetTokenDuration)
+		return err
+	}
+
+	if err := utils.Transaction(ac.db, forgotTransaction); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	if user != nil {
+		ac.sendPasswordResetEmail(user, token)
+	}
+
+	c.JSON(http.StatusOK, utils.ResponseData("success", "if the email belongs to an account, a password reset email was sent", nil))
+}
+
+// ResetPassword godoc
+// @Summary Reset password.
+// @Description set a new password with the token emailed by forgot password, every session of the user is revoked. Each token can only be used once.
+// @Tags Auth
+// @Accept application/json
+// @Param request body forms.ResetPasswordRequest true "request body"
+// @Produce json
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Router /api/v1/auth/password/reset [post]
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var input forms.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	resetTransaction := func(tx *gorm.DB) error {
+		token, err := service.ConsumeActionToken(tx, models.ActionTokenResetPassword, input.Token)
+		if err != nil {
+			return err
+		}
+
+		// The token was emailed to the user, which verifies their address as well
+		err = tx.Model(&models.User{}).Where("id = ? AND status = ?", token.UserID, models.UserStatusPending).
+			Update("status", models.UserStatusActive).Error
+		if err != nil {
+			return err
+		}
+
+		return service.SetPassword(tx, token.UserID, input.Password)
+	}
+
+	if err := utils.Transaction(ac.db, resetTransaction); err != nil {
+		if errors.Is(err, service.ErrInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.ResponseData("success", "success reset password", nil))
+}
+
+// ChangePassword godoc
+// @Summary Change password.
+// @Description change the password of the logged-in user, every session including the current one is revoked.
+// @Tags Users
+// @Accept application/json
+// @Param request body forms.ChangePasswordRequest true "request body"
+// @Produce json
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/users/me/password [put]
+func (ac *UserController) ChangePassword(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	var input forms.ChangePasswordRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	changePasswordTransaction := func(tx *gorm.DB) error {
+		user, err := ac.s.UserService.FindOne(authPayload.UserId, tx)
+		if err != nil {
+			return err
+		}
+
+		if err := utils.CheckPassword(input.OldPassword, user.Password); err != nil {
+			return errInvalidPassword
+		}
+
+		return service.SetPassword(tx, user.ID, input.NewPassword)
+	}
+
+	if err := utils.Transaction(ac.db, changePasswordTransaction); err != nil {
+		if errors.Is(err, errInvalidPassword) {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success change password, please signin again", nil))
+}
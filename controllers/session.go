@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errSessionNotFound = errors.New("session not found")
+
+// Sessions godoc
+// @Summary List the sessions of the logged-in user.
+// @Description get the signed in sessions of the logged-in user that were not revoked nor expired, newest first.
+// @Tags Users
+// @Accept */*
+// @Produce json
+// @Success 200 {object} utils.Response{data=forms.SessionsResponse}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/users/me/sessions [get]
+func (ac *UserController) Sessions(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	sessions, err := service.ActiveSessions(ac.db, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	response := forms.SessionsResponse{Sessions: make([]forms.Session, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, forms.Session{
+			ID:         session.SessionID,
+			Current:    session.SessionID == authPayload.SessionId,
+			ClientIP:   session.ClientIP,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.StartedAt,
+			LastUsedAt: session.CreatedAt,
+			ExpiresAt:  session.ExpiresAt,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get sessions", response))
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session.
+// @Description sign out one of the sessions of the logged-in user, its refresh and access tokens stop working.
+// @Tags Users
+// @Accept */*
+// @Produce json
+// @Param id path string true "session id"
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/users/me/sessions/{id} [delete]
+func (ac *UserController) RevokeSession(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	sessionID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid session id", nil))
+		return
+	}
+
+	revokeSessionTransaction := func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&models.Token{}).Where("session_id = ? AND user_id = ?", sessionID, authPayload.UserId).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return errSessionNotFound
+		}
+
+		return service.RevokeSession(tx, sessionID)
+	}
+
+	if err := utils.Transaction(ac.db, revokeSessionTransaction); err != nil {
+		if errors.Is(err, errSessionNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success revoke session", nil))
+}
+
+// RevokeSessions godoc
+// @Summary Sign out everywhere.
+// @Description revoke every session of the logged-in user, including the current one.
+// @Tags Users
+// @Accept */*
+// @Produce json
+// @Success 200 {object} utils.Response{data=forms.RevokeSessionsResponse}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/users/me/sessions [delete]
+func (ac *UserController) RevokeSessions(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	revoked, err := service.RevokeUserSessions(ac.db, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success revoke sessions", forms.RevokeSessionsResponse{
+		Revoked: revoked,
+	}))
+}
@@ -0,0 +1,315 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/storage"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const sharePasswordHeaderKey = "X-Share-Password"
+
+// signer creates the signer for share links, falling back to the token key
+// when no dedicated share link key is configured
+func (f *FilesystemController) signer() (*utils.Signer, error) {
+	key := f.config.ShareLinkKey
+	if key == "" {
+		key = f.config.TokenSymmetricKey
+	}
+	return utils.NewSigner(key)
+}
+
+// shareLinkResponse builds the response of a share link including its signed URL
+func (f *FilesystemController) shareLinkResponse(ctx *gin.Context, signer *utils.Signer, link *models.ShareLink) forms.ShareLinkResponse {
+	scheme := "http"
+	if ctx.Request.TLS != nil {
+		scheme = "https"
+	}
+
+	return forms.ShareLinkResponse{
+		ID:           link.ID,
+		FilesystemID: link.FilesystemID,
+		URL: fmt.Sprintf(
+			"%s://%s/api/v1/share/%d?expires=%d&signature=%s",
+			scheme,
+			ctx.Request.Host,
+			link.ID,
+			link.ExpiresAt.Unix(),
+			signer.Sign(link.ID, link.ExpiresAt),
+		),
+		ExpiresAt:     link.ExpiresAt,
+		MaxDownloads:  link.MaxDownloads,
+		DownloadCount: link.DownloadCount,
+		HasPassword:   link.PasswordHash != "",
+		RevokedAt:     link.RevokedAt,
+		CreatedAt:     link.CreatedAt,
+	}
+}
+
+// CreateShareLink godoc
+// @Summary Share a file.
+// @Description create a signed link that lets anyone download the file until it expires.
+// @Tags Share
+// @Accept application/json
+// @Param id path int true "file id"
+// @Param request body forms.CreateShareLinkRequest true "request body"
+// @Produce json
+// @Success 201 {object} utils.Response{data=forms.ShareLinkResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/share [post]
+func (f *FilesystemController) CreateShareLink(ctx *gin.Context) {
+	var input forms.CreateShareLinkRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	file, ok := f.findOwnedFile(ctx)
+	if !ok {
+		return
+	}
+
+	duration := f.config.ShareLinkDuration
+	if input.ExpiresIn > 0 {
+		duration = time.Duration(input.ExpiresIn) * time.Second
+	}
+	if duration > f.config.ShareLinkMaxDuration {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", fmt.Sprintf("share links can not last longer than %s", f.config.ShareLinkMaxDuration), nil))
+		return
+	}
+
+	signer, err := f.signer()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	link := &models.ShareLink{
+		UserID:       file.UserID,
+		FilesystemID: file.ID,
+		ExpiresAt:    time.Now().Add(duration).Truncate(time.Second),
+		MaxDownloads: input.MaxDownloads,
+	}
+
+	if input.Password != "" {
+		link.PasswordHash, err = utils.HashPassword(input.Password)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+	}
+
+	if _, err := f.s.ShareLinkService.Create(link, nil); err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, utils.ResponseData("success", "success create share link", f.shareLinkResponse(ctx, signer, link)))
+}
+
+// MyShareLinks godoc
+// @Summary Show logged-in user share links.
+// @Description get all share links created by the logged-in user.
+// @Tags Share
+// @Accept */*
+// @Produce json
+// @Success 200 {object} utils.Response{data=[]forms.ShareLinkResponse}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/shares [get]
+func (f *FilesystemController) MyShareLinks(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	signer, err := f.signer()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	var links []models.ShareLink
+	err = f.db.Where("user_id = ?", authPayload.UserId).Order("created_at desc").Find(&links).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	response := make([]forms.ShareLinkResponse, 0, len(links))
+	for i := range links {
+		response = append(response, f.shareLinkResponse(ctx, signer, &links[i]))
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get current user share links", response))
+}
+
+// RevokeShareLink godoc
+// @Summary Revoke a share link.
+// @Description revoke a share link so it can not be used anymore.
+// @Tags Share
+// @Accept */*
+// @Param id path int true "share link id"
+// @Produce json
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/shares/{id} [delete]
+func (f *FilesystemController) RevokeShareLink(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid share link id", nil))
+		return
+	}
+
+	result := f.db.Model(&models.ShareLink{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, authPayload.UserId).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", result.Error.Error(), nil))
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "Share link not found", nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success revoke share link", nil))
+}
+
+// DownloadShared godoc
+// @Summary Download a shared file
+// @Description Downloads a file through a signed share link, password protected links expect the password in the X-Share-Password header. Every response serving the first byte of the file counts toward the download limit, range requests resuming a download and conditional requests answered with 304 do not. Shared files are always streamed by the server, never redirected to the storage.
+// @Tags Share
+// @Accept */*
+// @Produce application/file
+// @Param id path int true "share link id"
+// @Param expires query int true "expiry of the link as unix time"
+// @Param signature query string true "signature of the link"
+// @Param X-Share-Password header string false "password of the link"
+// @Success 200 {object} utils.Response
+// @Failure 401 {object} utils.Response{data=object}
+// @Failure 403 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 410 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Router /api/v1/share/{id} [get]
+func (f *FilesystemController) DownloadShared(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "Share link not found", nil))
+		return
+	}
+
+	expires, err := strconv.ParseInt(ctx.Query("expires"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, utils.ResponseData("error", utils.ErrInvalidSignature.Error(), nil))
+		return
+	}
+
+	signer, err := f.signer()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	err = signer.Verify(id, time.Unix(expires, 0), ctx.Query("signature"))
+	if errors.Is(err, utils.ErrExpiredSignature) {
+		ctx.JSON(http.StatusGone, utils.ResponseData("error", "share link has expired", nil))
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	var link models.ShareLink
+	if err := f.db.Where("id = ?", id).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "Share link not found", nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	// The signature only covers the expiry in the URL, it must match the stored one
+	if link.ExpiresAt.Unix() != expires {
+		ctx.JSON(http.StatusForbidden, utils.ResponseData("error", utils.ErrInvalidSignature.Error(), nil))
+		return
+	}
+
+	if link.RevokedAt != nil {
+		ctx.JSON(http.StatusGone, utils.ResponseData("error", "share link has been revoked", nil))
+		return
+	}
+
+	if link.PasswordHash != "" {
+		password := ctx.GetHeader(sharePasswordHeaderKey)
+		if password == "" {
+			ctx.JSON(http.StatusUnauthorized, utils.ResponseData("error", "share link requires a password", nil))
+			return
+		}
+		if err := utils.CheckPassword(password, link.PasswordHash); err != nil {
+			ctx.JSON(http.StatusForbidden, utils.ResponseData("error", "invalid share link password", nil))
+			return
+		}
+	}
+
+	var file models.Filesystem
+	if err := f.db.Where("id = ? AND user_id = ?", link.FilesystemID, link.UserID).First(&file).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "File not found", nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	info, err := f.s.Storage.Stat(ctx.Request.Context(), file.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "File not found", nil))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	// Count the download atomically so concurrent requests can not exceed the limit. HEAD
+	// requests, 304 answers and ranges resuming a download past the first byte are not
+	// counted
+	etag := ""
+	if file.Sha256 != "" {
+		etag = utils.StrongETag(file.Sha256)
+	}
+	if ctx.Request.Method != http.MethodHead && utils.IsFullDownload(ctx.Request, etag, file.UpdatedAt, info.Size) {
+		result := f.db.Model(&models.ShareLink{}).
+			Where("id = ? AND revoked_at IS NULL AND (max_downloads IS NULL OR download_count < max_downloads)", link.ID).
+			Update("download_count", gorm.Expr("download_count + 1"))
+		if result.Error != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", result.Error.Error(), nil))
+			return
+		}
+		if result.RowsAffected == 0 {
+			ctx.JSON(http.StatusGone, utils.ResponseData("error", "share link has reached its download limit", nil))
+			return
+		}
+	}
+
+	// Shared files are never redirected to a presigned URL, which could be downloaded again
+	// without being counted until it expires
+	f.streamFile(ctx, &file)
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeleteFile godoc
+// @Summary Delete a file.
+// @Description moves a file of the logged-in user to the trash, it can be restored until it is purged.
+// @Tags Trash
+// @Accept */*
+// @Produce json
+// @Param id path int true "file id"
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id} [delete]
+func (f *FilesystemController) DeleteFile(ctx *gin.Context) {
+	file, ok := f.findOwnedFile(ctx)
+	if !ok {
+		return
+	}
+
+	if err := f.db.Delete(file).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success move file to trash", nil))
+}
+
+// Trash godoc
+// @Summary List the trash.
+// @Description get the trashed files of the logged-in user, most recently deleted first.
+// @Tags Trash
+// @Accept */*
+// @Produce json
+// @Success 200 {object} utils.Response{data=forms.TrashResponse}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/trash [get]
+func (f *FilesystemController) Trash(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	var files []models.Filesystem
+	err := f.db.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", authPayload.UserId).
+		Order("deleted_at desc").
+		Find(&files).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	response := forms.TrashResponse{Files: []forms.TrashedFile{}}
+	for _, file := range files {
+		response.Files = append(response.Files, forms.TrashedFile{
+			Filesystem: file,
+			PurgeAt:    file.DeletedAt.Time.Add(f.config.TrashRetention),
+		})
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get trash", response))
+}
+
+// RestoreTrashedFile godoc
+// @Summary Restore a trashed file.
+// @Description moves a file of the logged-in user out of the trash, back to its folder or to the root when the folder was deleted.
+// @Tags Trash
+// @Accept */*
+// @Produce json
+// @Param id path int true "file id"
+// @Success 200 {object} utils.Response{data=models.Filesystem}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 409 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/trash/{id}/restore [post]
+func (f *FilesystemController) RestoreTrashedFile(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid file id", nil))
+		return
+	}
+
+	var file models.Filesystem
+	restoreTransaction := func(tx *gorm.DB) error {
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, authPayload.UserId).
+			First(&file).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errFileNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if file.FolderID != nil {
+			if _, err := findUserFolder(tx, authPayload.UserId, *file.FolderID); errors.Is(err, errFolderNotFound) {
+				file.FolderID = nil
+			} else if err != nil {
+				return err
+			}
+		}
+
+		existing, err := service.FindFileByPath(tx, authPayload.UserId, file.FolderID, file.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return service.ErrFileExists
+		}
+
+		file.DeletedAt = gorm.DeletedAt{}
+		return tx.Unscoped().Model(&file).Updates(map[string]any{
+			"folder_id":  file.FolderID,
+			"deleted_at": nil,
+		}).Error
+	}
+
+	if err := utils.Transaction(f.db, restoreTransaction); err != nil {
+		fileErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success restore file", file))
+}
+
+// EmptyTrash godoc
+// @Summary Empty the trash.
+// @Description permanently deletes every trashed file of the logged-in user with its versions.
+// @Tags Trash
+// @Accept */*
+// @Produce json
+// @Success 200 {object} utils.Response{data=forms.EmptyTrashResponse}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/trash [delete]
+func (f *FilesystemController) EmptyTrash(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	var files []models.Filesystem
+	var storageKeys []string
+	emptyTransaction := func(tx *gorm.DB) error {
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND deleted_at IS NOT NULL", authPayload.UserId).
+			Find(&files).Error
+		if err != nil {
+			return err
+		}
+
+		storageKeys, err = service.DeleteFiles(tx, authPayload.UserId, files)
+		return err
+	}
+
+	if err := utils.Transaction(f.db, emptyTransaction); err != nil {
+		fileErrorResponse(ctx, err)
+		return
+	}
+
+	// Remove the content of files not backed by a blob once the records are gone
+	for _, key := range storageKeys {
+		_ = f.s.Storage.Delete(context.Background(), key)
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success empty trash", forms.EmptyTrashResponse{
+		Deleted: len(files),
+	}))
+}
@@ -0,0 +1,519 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/config"
+	"github.com/dbsSensei/filesystem-api/jobs"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	tusVersion           = "1.0.0"
+	tusExtensions        = "creation,termination,expiration"
+	tusOffsetContentType = "application/offset+octet-stream"
+
+	tusResumableHeaderKey = "Tus-Resumable"
+	tusVersionHeaderKey   = "Tus-Version"
+	tusExtensionHeaderKey = "Tus-Extension"
+	tusMaxSizeHeaderKey   = "Tus-Max-Size"
+	uploadLengthHeaderKey = "Upload-Length"
+	uploadOffsetHeaderKey = "Upload-Offset"
+	uploadMetaHeaderKey   = "Upload-Metadata"
+	uploadExpiresKey      = "Upload-Expires"
+	jobIDHeaderKey        = "X-Extraction-Job-Id"
+)
+
+// TusController implements the tus 1.0 resumable upload protocol with the creation,
+// termination and expiration extensions. Chunks are appended to a file in the upload
+// folder and the offsets are saved in the database, completed uploads are queued for
+// extraction. Uploads left without a chunk for TusUploadExpiry are purged by the pool.
+type TusController struct {
+	config *config.Config
+	db     *gorm.DB
+	s      *service.Services
+
+	// locks serializes the requests writing to the same upload
+	locks sync.Map
+}
+
+func NewTusController(config *config.Config, db *gorm.DB, s *service.Services) *TusController {
+	return &TusController{
+		config: config,
+		db:     db,
+		s:      s,
+	}
+}
+
+func (t *TusController) lock(id uuid.UUID) func() {
+	value, _ := t.locks.LoadOrStore(id, &sync.Mutex{})
+	mutex := value.(*sync.Mutex)
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+func (t *TusController) uploadPath(id uuid.UUID) string {
+	return filepath.Join(t.config.TusUploadPath, id.String())
+}
+
+// uploadExpires is when an incomplete upload expires, each chunk received postpones it
+func (t *TusController) uploadExpires(upload *models.Upload) time.Time {
+	return upload.UpdatedAt.Add(t.config.TusUploadExpiry)
+}
+
+// setUploadExpires sets the Upload-Expires header of an incomplete upload
+func (t *TusController) setUploadExpires(ctx *gin.Context, upload *models.Upload) {
+	if upload.JobID == nil {
+		ctx.Header(uploadExpiresKey, t.uploadExpires(upload).UTC().Format(http.TimeFormat))
+	}
+}
+
+// checkVersion rejects requests speaking another version of the protocol
+func (t *TusController) checkVersion(ctx *gin.Context) bool {
+	ctx.Header(tusResumableHeaderKey, tusVersion)
+
+	if ctx.GetHeader(tusResumableHeaderKey) != tusVersion {
+		ctx.Header(tusVersionHeaderKey, tusVersion)
+		ctx.AbortWithStatusJSON(http.StatusPreconditionFailed, utils.ResponseData("error", "unsupported tus version", nil))
+		return false
+	}
+	return true
+}
+
+// findUpload loads the upload identified by the id path param, uploads of other users are not found
+func (t *TusController) findUpload(ctx *gin.Context) (*models.Upload, bool) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ResponseData("error", "Upload not found", nil))
+		return nil, false
+	}
+
+	var upload models.Upload
+	err = t.db.Where("id = ? AND user_id = ?", id, authPayload.UserId).First(&upload).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ResponseData("error", "Upload not found", nil))
+			return nil, false
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return nil, false
+	}
+
+	return &upload, true
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header made of comma separated
+// key and base64 encoded value pairs
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid upload metadata %q", pair)
+		}
+
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid upload metadata value for %q", fields[0])
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+
+	return metadata, nil
+}
+
+// Options godoc
+// @Summary Discover the tus server capabilities.
+// @Description returns the supported tus version, extensions and maximum upload size.
+// @Tags Uploads
+// @Success 204
+// @Router /api/v1/filesystem/uploads [options]
+func (t *TusController) Options(ctx *gin.Context) {
+	ctx.Header(tusResumableHeaderKey, tusVersion)
+	ctx.Header(tusVersionHeaderKey, tusVersion)
+	ctx.Header(tusExtensionHeaderKey, tusExtensions)
+	if t.config.TusMaxSize > 0 {
+		ctx.Header(tusMaxSizeHeaderKey, strconv.FormatInt(t.config.TusMaxSize, 10))
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// Create godoc
+// @Summary Create a resumable upload.
+// @Description create a tus upload of Upload-Length bytes, the filename, extract and inspect entries of Upload-Metadata are used once the upload completes.
+// @Tags Uploads
+// @Param Tus-Resumable header string true "tus version, 1.0.0"
+// @Param Upload-Length header int true "size of the upload in bytes"
+// @Param Upload-Metadata header string false "tus metadata, filename, extract and inspect keys are supported"
+// @Success 201
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 412 {object} utils.Response{data=object}
+// @Failure 413 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/uploads [post]
+func (t *TusController) Create(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	if !t.checkVersion(ctx) {
+		return
+	}
+
+	length, err := strconv.ParseInt(ctx.GetHeader(uploadLengthHeaderKey), 10, 64)
+	if err != nil || length < 0 {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid Upload-Length", nil))
+		return
+	}
+	if t.config.TusMaxSize > 0 && length > t.config.TusMaxSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, utils.ResponseData("error", "upload exceeds the maximum size", nil))
+		return
+	}
+
+	if !checkUploadQuota(ctx, t.config, t.s, authPayload.UserId, length) {
+		return
+	}
+
+	rawMetadata := ctx.GetHeader(uploadMetaHeaderKey)
+	metadata, err := parseUploadMetadata(rawMetadata)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	extract := true
+	if value, ok := metadata["extract"]; ok {
+		extract, err = strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid extract metadata", nil))
+			return
+		}
+	}
+
+	inspect := false
+	if value, ok := metadata["inspect"]; ok {
+		inspect, err = strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid inspect metadata", nil))
+			return
+		}
+	}
+
+	filename := filepath.Base(metadata["filename"])
+	if !validEntryName(filename) {
+		filename = "upload"
+	}
+
+	upload := &models.Upload{
+		ID:       uuid.New(),
+		UserID:   authPayload.UserId,
+		Length:   length,
+		Filename: filename,
+		Metadata: rawMetadata,
+		Extract:  extract,
+		Inspect:  inspect,
+	}
+
+	if err := os.MkdirAll(t.config.TusUploadPath, os.ModePerm); err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	file, err := os.Create(t.uploadPath(upload.ID))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	file.Close()
+
+	if _, err := t.s.UploadService.Create(upload, nil); err != nil {
+		os.Remove(t.uploadPath(upload.ID))
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	// Empty uploads are complete right away
+	if upload.Length == 0 {
+		if err := t.complete(upload); err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		ctx.Header(jobIDHeaderKey, strconv.Itoa(*upload.JobID))
+	}
+
+	t.setUploadExpires(ctx, upload)
+	ctx.Header("Location", ctx.Request.URL.Path+"/"+upload.ID.String())
+	ctx.Status(http.StatusCreated)
+}
+
+// Head godoc
+// @Summary Show a resumable upload offset.
+// @Description returns the Upload-Offset to resume the upload from and the Upload-Expires of an incomplete upload.
+// @Tags Uploads
+// @Param id path string true "upload id"
+// @Param Tus-Resumable header string true "tus version, 1.0.0"
+// @Success 200
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 412 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/uploads/{id} [head]
+func (t *TusController) Head(ctx *gin.Context) {
+	if !t.checkVersion(ctx) {
+		return
+	}
+
+	upload, ok := t.findUpload(ctx)
+	if !ok {
+		return
+	}
+
+	// Every byte was received but the upload could not be queued, try again
+	if upload.JobID == nil && upload.Offset == upload.Length {
+		if err := t.resumeCompletion(upload); err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header(uploadOffsetHeaderKey, strconv.FormatInt(upload.Offset, 10))
+	ctx.Header(uploadLengthHeaderKey, strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		ctx.Header(uploadMetaHeaderKey, upload.Metadata)
+	}
+	if upload.JobID != nil {
+		ctx.Header(jobIDHeaderKey, strconv.Itoa(*upload.JobID))
+	}
+	t.setUploadExpires(ctx, upload)
+	ctx.Status(http.StatusOK)
+}
+
+// Patch godoc
+// @Summary Append to a resumable upload.
+// @Description appends the request body at Upload-Offset, once every byte is received the upload is queued for extraction and the job id is returned in X-Extraction-Job-Id. Uploads not resumed before their Upload-Expires are deleted.
+// @Tags Uploads
+// @Accept application/offset+octet-stream
+// @Param id path string true "upload id"
+// @Param Tus-Resumable header string true "tus version, 1.0.0"
+// @Param Upload-Offset header int true "offset the body starts at"
+// @Success 204
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 409 {object} utils.Response{data=object}
+// @Failure 410 {object} utils.Response{data=object}
+// @Failure 412 {object} utils.Response{data=object}
+// @Failure 415 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/uploads/{id} [patch]
+func (t *TusController) Patch(ctx *gin.Context) {
+	if !t.checkVersion(ctx) {
+		return
+	}
+
+	if ctx.GetHeader("Content-Type") != tusOffsetContentType {
+		ctx.JSON(http.StatusUnsupportedMediaType, utils.ResponseData("error", "content type must be "+tusOffsetContentType, nil))
+		return
+	}
+
+	offset, err := strconv.ParseInt(ctx.GetHeader(uploadOffsetHeaderKey), 10, 64)
+	if err != nil || offset < 0 {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid Upload-Offset", nil))
+		return
+	}
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "Upload not found", nil))
+		return
+	}
+	unlock := t.lock(id)
+	defer unlock()
+
+	upload, ok := t.findUpload(ctx)
+	if !ok {
+		return
+	}
+
+	if upload.JobID != nil {
+		ctx.JSON(http.StatusForbidden, utils.ResponseData("error", "upload is already complete", nil))
+		return
+	}
+
+	if time.Now().After(t.uploadExpires(upload)) {
+		ctx.JSON(http.StatusGone, utils.ResponseData("error", "upload has expired", nil))
+		return
+	}
+
+	if offset != upload.Offset {
+		ctx.JSON(http.StatusConflict, utils.ResponseData("error", "Upload-Offset does not match the current offset", nil))
+		return
+	}
+
+	// Every byte was received but the upload could not be queued, try again
+	if upload.Offset == upload.Length {
+		if err := t.complete(upload); err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		ctx.Header(jobIDHeaderKey, strconv.Itoa(*upload.JobID))
+		ctx.Header(uploadOffsetHeaderKey, strconv.FormatInt(upload.Offset, 10))
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+
+	file, err := os.OpenFile(t.uploadPath(upload.ID), os.O_WRONLY, 0)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	defer file.Close()
+
+	// Drop the bytes written after the last saved offset, a previous request
+	// may have been interrupted before its offset was saved
+	if err := file.Truncate(upload.Offset); err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	// Keep whatever was received even when the client disconnects, so it can resume
+	written, copyErr := io.Copy(file, io.LimitReader(ctx.Request.Body, upload.Length-upload.Offset))
+	if err := file.Sync(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	upload.Offset += written
+	if err := t.db.Model(upload).Update("offset", upload.Offset).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	if copyErr != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", copyErr.Error(), nil))
+		return
+	}
+
+	if upload.Offset == upload.Length {
+		if err := t.complete(upload); err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		ctx.Header(jobIDHeaderKey, strconv.Itoa(*upload.JobID))
+	}
+
+	t.setUploadExpires(ctx, upload)
+	ctx.Header(uploadOffsetHeaderKey, strconv.FormatInt(upload.Offset, 10))
+	ctx.Status(http.StatusNoContent)
+}
+
+// complete hands a fully received upload over to the extraction pipeline. The upload
+// is not tied to the request, a client disconnecting once it sent the last byte does not
+// interrupt it. When it fails, the next PATCH or HEAD of the upload completes it again.
+func (t *TusController) complete(upload *models.Upload) error {
+	file, err := os.Open(t.uploadPath(upload.ID))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	job, err := jobs.Enqueue(context.Background(), t.s, upload.UserID, upload.Filename, file, upload.Length, upload.Extract, upload.Inspect)
+	if err != nil {
+		return err
+	}
+
+	upload.JobID = &job.ID
+	if err := t.db.Model(upload).Update("job_id", upload.JobID).Error; err != nil {
+		return err
+	}
+
+	os.Remove(t.uploadPath(upload.ID))
+
+	// Completed uploads are not written to anymore
+	t.locks.Delete(upload.ID)
+	return nil
+}
+
+// resumeCompletion completes a fully received upload that could not be queued, unless
+// a concurrent request queued it in the meantime
+func (t *TusController) resumeCompletion(upload *models.Upload) error {
+	unlock := t.lock(upload.ID)
+	defer unlock()
+
+	if err := t.db.Where("id = ?", upload.ID).First(upload).Error; err != nil {
+		return err
+	}
+	if upload.JobID != nil {
+		return nil
+	}
+
+	return t.complete(upload)
+}
+
+// Terminate godoc
+// @Summary Terminate a resumable upload.
+// @Description deletes an upload and the bytes received so far.
+// @Tags Uploads
+// @Param id path string true "upload id"
+// @Param Tus-Resumable header string true "tus version, 1.0.0"
+// @Success 204
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 412 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/uploads/{id} [delete]
+func (t *TusController) Terminate(ctx *gin.Context) {
+	if !t.checkVersion(ctx) {
+		return
+	}
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", "Upload not found", nil))
+		return
+	}
+	unlock := t.lock(id)
+	defer unlock()
+
+	upload, ok := t.findUpload(ctx)
+	if !ok {
+		return
+	}
+
+	if err := t.db.Delete(upload).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	os.Remove(t.uploadPath(upload.ID))
+	t.locks.Delete(upload.ID)
+	ctx.Status(http.StatusNoContent)
+}
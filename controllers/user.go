@@ -3,7 +3,6 @@ package controllers
 import (
 	"github.com/dbsSensei/filesystem-api/config"
 	"github.com/dbsSensei/filesystem-api/forms"
-	"github.com/dbsSensei/filesystem-api/models"
 	"github.com/dbsSensei/filesystem-api/service"
 	"github.com/dbsSensei/filesystem-api/utils"
 	"github.com/gin-gonic/gin"
@@ -37,17 +36,63 @@ func NewUserController(config *config.Config, db *gorm.DB, s *service.Services)
 // @Router /api/v1/users/me [get]
 func (ac *UserController) Me(ctx *gin.Context) {
 	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
-	result, err := ac.s.UserService.FindOne(authPayload.UserId, nil)
+	user, err := ac.s.UserService.FindOne(authPayload.UserId, nil)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
 		return
 	}
-	user := result.(*models.User)
+	quota := service.UserQuota(ac.c, user)
 
 	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get current user", forms.WhoAmIResponse{
 		ID:     user.ID,
 		Name:   user.Name,
 		Email:  user.Email,
 		Status: string(user.Status),
+		Quota: forms.Quota{
+			UsedBytes: user.UsedBytes,
+			MaxBytes:  quota.MaxBytes,
+			UsedFiles: user.UsedFiles,
+			MaxFiles:  quota.MaxFiles,
+		},
 	}))
 }
+
+// Storage godoc
+// @Summary Show logged-in user storage usage.
+// @Description get the logical size of the logged-in user files and their versions outside the trash, and the physical size of their deduplicated contents.
+// @Tags Users
+// @Accept */*
+// @Produce json
+// @Success 200 {object} utils.Response{data=forms.StorageUsageResponse}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/users/me/storage [get]
+func (ac *UserController) Storage(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	// Contents are the live files and their versions, trashed files are left out. Hashed
+	// contents share the object of their blob, the others own their object.
+	var usage forms.StorageUsageResponse
+	err := ac.db.Raw(`
+		WITH contents AS (
+			SELECT sha256, size FROM filesystem
+			WHERE user_id = @user_id AND deleted_at IS NULL
+			UNION ALL
+			SELECT file_versions.sha256, file_versions.size FROM file_versions
+			JOIN filesystem ON filesystem.id = file_versions.filesystem_id
+			WHERE filesystem.user_id = @user_id AND filesystem.deleted_at IS NULL
+		)
+		SELECT
+			(SELECT COUNT(*) FROM filesystem WHERE user_id = @user_id AND deleted_at IS NULL) AS files,
+			(SELECT COALESCE(SUM(size), 0) FROM contents) AS logical_bytes,
+			(SELECT COALESCE(SUM(size), 0) FROM blobs WHERE sha256 IN (SELECT sha256 FROM contents WHERE sha256 <> '')) +
+				(SELECT COALESCE(SUM(size), 0) FROM contents WHERE sha256 = '') AS physical_bytes`,
+		map[string]any{"user_id": authPayload.UserId}).Scan(&usage).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	usage.SavedBytes = usage.LogicalBytes - usage.PhysicalBytes
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get current user storage usage", usage))
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/mailer"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// actionEmailInterval is the minimum time between two emails of the same kind sent to a user
+const actionEmailInterval = time.Minute
+
+// sendEmail sends message to the user in the background, so that the response does not
+// take longer when an email is sent and does not tell which addresses have an account.
+// A failure is logged since the user can ask for another email.
+func (ac *AuthController) sendEmail(user *models.User, message mailer.Message) {
+	userID := user.ID
+	go func() {
+		if err := ac.s.Mailer.Send(context.Background(), message); err != nil {
+			log.Printf("failed to send %q email to user %d: %v", message.Subject, userID, err)
+		}
+	}()
+}
+
+// sendVerificationEmail emails the verification token to the user, once the token is committed
+func (ac *AuthController) sendVerificationEmail(user *models.User, token string) {
+	body := "Hi " + user.Name + ",\n\n"
+	if ac.c.VerificationURL != "" {
+		body += "Open the following link to verify your email address:\n\n" + ac.c.VerificationURL + token + "\n\n"
+	} else {
+		body += "Use the following token to verify your email address:\n\n" + token + "\n\n"
+	}
+	body += "It expires in " + ac.c.VerificationTokenDuration.String() + ". If you did not create an account, you can ignore this email.\n"
+
+	ac.sendEmail(user, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    body,
+	})
+}
+
+// Verify godoc
+// @Summary Verify email.
+// @Description activate the account of the user the verification token was emailed to. Each token can only be used once.
+// @Tags Auth
+// @Accept application/json
+// @Param request body forms.VerifyEmailRequest true "request body"
+// @Produce json
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Router /api/v1/auth/verify [post]
+func (ac *AuthController) Verify(c *gin.Context) {
+	var input forms.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	verifyTransaction := func(tx *gorm.DB) error {
+		token, err := service.ConsumeActionToken(tx, models.ActionTokenVerifyEmail, input.Token)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", token.UserID).Update("status", models.UserStatusActive).Error
+	}
+
+	if err := utils.Transaction(ac.db, verifyTransaction); err != nil {
+		if errors.Is(err, service.ErrInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.ResponseData("success", "success verify email", nil))
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email.
+// @Description email a new verification token to a pending account, the previous ones stop working. The response does not tell whether the email belongs to an account, and at most one email is sent per minute.
+// @Tags Auth
+// @Accept application/json
+// @Param request body forms.ResendVerificationRequest true "request body"
+// @Produce json
+// @Success 200 {object} utils.Response{data=object}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Router /api/v1/auth/verify/resend [post]
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	var input forms.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	var user *models.User
+	var token string
+	resendTransaction := func(tx *gorm.DB) error {
+		users, err := ac.s.UserService.FindAll(func(query *gorm.DB) *gorm.DB {
+			return query.Where("LOWER(email) = ?", strings.ToLower(input.Email)).Limit(1)
+		}, tx)
+		if err != nil || len(users) == 0 || users[0].Status != models.UserStatusPending {
+			return err
+		}
+
+		lastSentAt, err := service.LastActionTokenAt(tx, users[0].ID, models.ActionTokenVerifyEmail)
+		if err != nil || time.Since(lastSentAt) < actionEmailInterval {
+			return err
+		}
+
+		user = &users[0]
+		token, err = service.IssueActionToken(tx, user.ID, models.ActionTokenVerifyEmail, ac.c.VerificationTokenDuration)
+		return err
+	}
+
+	if err := utils.Transaction(ac.db, resendTransaction); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	if user != nil {
+		ac.sendVerificationEmail(user, token)
+	}
+
+	c.JSON(http.StatusOK, utils.ResponseData("success", "if the account is pending verification, a new email was sent", nil))
+}
@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/forms"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errFileNotFound       = errors.New("file not found")
+	errVersionNotFound    = errors.New("version not found")
+	errVersionIsCurrent   = errors.New("version is already the current one")
+	errInvalidPruneParams = errors.New("keep or older_than is required")
+)
+
+// versionErrorResponse writes the error of a version operation
+func versionErrorResponse(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errFileNotFound), errors.Is(err, errVersionNotFound):
+		ctx.JSON(http.StatusNotFound, utils.ResponseData("error", err.Error(), nil))
+	case errors.Is(err, errVersionIsCurrent):
+		ctx.JSON(http.StatusConflict, utils.ResponseData("error", err.Error(), nil))
+	case errors.Is(err, service.ErrQuotaExceeded):
+		ctx.JSON(http.StatusRequestEntityTooLarge, utils.ResponseData("error", err.Error(), nil))
+	default:
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+	}
+}
+
+// lockUserFile loads a file owned by the user, locking it for the rest of the transaction
+func lockUserFile(tx *gorm.DB, userID int, id int) (*models.Filesystem, error) {
+	var file models.Filesystem
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND user_id = ?", id, userID).First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// findFileVersion loads a previous version of a file
+func findFileVersion(db *gorm.DB, fileID int, version int) (*models.FileVersion, error) {
+	var fileVersion models.FileVersion
+	err := db.Where("filesystem_id = ? AND version = ?", fileID, version).First(&fileVersion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fileVersion, nil
+}
+
+// FileVersions godoc
+// @Summary List the versions of a file.
+// @Description get every version of a file owned by the logged-in user, newest first.
+// @Tags Versions
+// @Accept */*
+// @Produce json
+// @Param id path int true "file id"
+// @Success 200 {object} utils.Response{data=forms.FileVersionsResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/versions [get]
+func (f *FilesystemController) FileVersions(ctx *gin.Context) {
+	file, ok := f.findOwnedFile(ctx)
+	if !ok {
+		return
+	}
+
+	var previous []models.FileVersion
+	if err := f.db.Where("filesystem_id = ?", file.ID).Order("version desc").Find(&previous).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+
+	versions := []forms.FileVersion{{
+		Version:     file.Version,
+		Current:     true,
+		FileContent: file.FileContent,
+		CreatedAt:   file.UpdatedAt,
+	}}
+	for _, version := range previous {
+		versions = append(versions, forms.FileVersion{
+			Version:     version.Version,
+			FileContent: version.FileContent,
+			CreatedAt:   version.CreatedAt,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success get file versions", forms.FileVersionsResponse{
+		FileID:   file.ID,
+		Versions: versions,
+	}))
+}
+
+// DownloadFileVersion godoc
+// @Summary Download a version of a file.
+// @Description downloads a version of a file owned by the logged-in user, with the same range and conditional request support as the latest one.
+// @Tags Versions
+// @Accept */*
+// @Produce application/file
+// @Param id path int true "file id"
+// @Param version path int true "version number"
+// @Success 200 {object} utils.Response
+// @Success 206 {object} utils.Response "the requested byte ranges"
+// @Success 304 {object} utils.Response "not modified"
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/versions/{version}/download [get]
+func (f *FilesystemController) DownloadFileVersion(ctx *gin.Context) {
+	file, ok := f.findOwnedFile(ctx)
+	if !ok {
+		return
+	}
+
+	number, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid version", nil))
+		return
+	}
+
+	if number == file.Version {
+		f.serveFile(ctx, file)
+		return
+	}
+
+	version, err := findFileVersion(f.db, file.ID, number)
+	if err != nil {
+		versionErrorResponse(ctx, err)
+		return
+	}
+
+	// Versions are served under the name of the file, they are never hashed lazily
+	f.serveFile(ctx, &models.Filesystem{
+		UserID:      file.UserID,
+		Name:        file.Name,
+		Version:     version.Version,
+		FileContent: version.FileContent,
+		UpdatedAt:   version.CreatedAt,
+	})
+}
+
+// RestoreFileVersion godoc
+// @Summary Restore a version of a file.
+// @Description makes a copy of a previous version the new current version of a file owned by the logged-in user, the history is kept.
+// @Tags Versions
+// @Accept */*
+// @Produce json
+// @Param id path int true "file id"
+// @Param version path int true "version number"
+// @Success 200 {object} utils.Response{data=models.Filesystem}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 409 {object} utils.Response{data=object}
+// @Failure 413 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/versions/{version}/restore [post]
+func (f *FilesystemController) RestoreFileVersion(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid file id", nil))
+		return
+	}
+	number, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid version", nil))
+		return
+	}
+
+	user, err := f.s.UserService.FindOne(authPayload.UserId, nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+		return
+	}
+	quota := service.UserQuota(f.config, user)
+
+	var file *models.Filesystem
+	var staleKey string
+	restoreTransaction := func(tx *gorm.DB) error {
+		file, err = lockUserFile(tx, authPayload.UserId, id)
+		if err != nil {
+			return err
+		}
+		if number == file.Version {
+			return errVersionIsCurrent
+		}
+
+		version, err := findFileVersion(tx, file.ID, number)
+		if err != nil {
+			return err
+		}
+
+		// Versions of files stored before blobs existed own their object, move it to
+		// a blob so the restored copy can share it
+		if version.Sha256 == "" {
+			staleKey, err = f.linkVersionBlob(ctx.Request.Context(), tx, authPayload.UserId, version)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := service.ChargeUsage(tx, authPayload.UserId, quota, version.Size, 0); err != nil {
+			return err
+		}
+		if _, err := service.AcquireBlob(tx, version.Sha256, version.StorageKey, version.Size); err != nil {
+			return err
+		}
+
+		if err := service.PushVersion(tx, file); err != nil {
+			return err
+		}
+		file.FileContent = version.FileContent
+		return tx.Save(file).Error
+	}
+
+	if err := utils.Transaction(f.db, restoreTransaction); err != nil {
+		versionErrorResponse(ctx, err)
+		return
+	}
+
+	if staleKey != "" {
+		_ = f.s.Storage.Delete(context.Background(), staleKey)
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success restore file version", file))
+}
+
+// linkVersionBlob hashes the content of a version not backed by a blob and links it to
+// the blob of its content. When the content was already stored in a blob, the storage key
+// the version used to own is returned so it can be deleted once the transaction commits.
+func (f *FilesystemController) linkVersionBlob(ctx context.Context, tx *gorm.DB, userID int, version *models.FileVersion) (string, error) {
+	reader, err := f.s.Storage.Get(ctx, version.StorageKey)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return "", err
+	}
+
+	staleKey, err := service.LinkContent(tx, userID, &version.FileContent, hex.EncodeToString(hash.Sum(nil)), size)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Model(version).UpdateColumns(map[string]any{
+		"sha256":      version.Sha256,
+		"storage_key": version.StorageKey,
+		"size":        version.Size,
+	}).Error
+	return staleKey, err
+}
+
+// PruneFileVersions godoc
+// @Summary Prune the versions of a file.
+// @Description deletes the previous versions of a file owned by the logged-in user beyond the keep newest ones, or older than older_than. The current version is never deleted.
+// @Tags Versions
+// @Accept */*
+// @Produce json
+// @Param id path int true "file id"
+// @Param keep query int false "number of previous versions to keep"
+// @Param older_than query string false "delete the versions older than this duration, e.g. 720h"
+// @Success 200 {object} utils.Response{data=forms.PruneFileVersionsResponse}
+// @Failure 400 {object} utils.Response{data=object}
+// @Failure 404 {object} utils.Response{data=object}
+// @Failure 500 {object} utils.Response{data=object}
+// @Security ApiKeyAuth
+// @Router /api/v1/filesystem/files/{id}/versions [delete]
+func (f *FilesystemController) PruneFileVersions(ctx *gin.Context) {
+	authPayload := ctx.MustGet("authorization_payload").(*utils.TokenPayload)
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid file id", nil))
+		return
+	}
+
+	keep := -1
+	if value := ctx.Query("keep"); value != "" {
+		keep, err = strconv.Atoi(value)
+		if err != nil || keep < 0 {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid keep", nil))
+			return
+		}
+	}
+
+	var olderThan time.Duration
+	if value := ctx.Query("older_than"); value != "" {
+		olderThan, err = time.ParseDuration(value)
+		if err != nil || olderThan <= 0 {
+			ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", "invalid older_than", nil))
+			return
+		}
+	}
+
+	if keep < 0 && olderThan == 0 {
+		ctx.JSON(http.StatusBadRequest, utils.ResponseData("error", errInvalidPruneParams.Error(), nil))
+		return
+	}
+
+	var pruned []models.FileVersion
+	var storageKeys []string
+	pruneTransaction := func(tx *gorm.DB) error {
+		file, err := lockUserFile(tx, authPayload.UserId, id)
+		if err != nil {
+			return err
+		}
+
+		var versions []models.FileVersion
+		if err := tx.Where("filesystem_id = ?", file.ID).Order("version desc").Find(&versions).Error; err != nil {
+			return err
+		}
+
+		cutoff := time.Now().Add(-olderThan)
+		for i, version := range versions {
+			if (keep >= 0 && i >= keep) || (olderThan > 0 && version.CreatedAt.Before(cutoff)) {
+				pruned = append(pruned, version)
+			}
+		}
+
+		storageKeys, err = service.DeleteVersions(tx, authPayload.UserId, pruned)
+		return err
+	}
+
+	if err := utils.Transaction(f.db, pruneTransaction); err != nil {
+		versionErrorResponse(ctx, err)
+		return
+	}
+
+	// Remove the content of versions not backed by a blob once the records are gone
+	for _, key := range storageKeys {
+		_ = f.s.Storage.Delete(context.Background(), key)
+	}
+
+	ctx.JSON(http.StatusOK, utils.ResponseData("success", "success prune file versions", forms.PruneFileVersionsResponse{
+		Deleted: len(pruned),
+	}))
+}
@@ -8,6 +8,7 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"reflect"
+	"time"
 )
 
 var DB *gorm.DB
@@ -40,13 +41,203 @@ func migrationInit(db *gorm.DB) error {
 			return fmt.Errorf("AutoMigrate failed for model %v: %v\n", reflect.TypeOf(m), err)
 		}
 	}
+
+	if err := uniqueFolderNames(db); err != nil {
+		return fmt.Errorf("failed to index folder names: %v", err)
+	}
+
+	if err := uniqueFileNames(db); err != nil {
+		return fmt.Errorf("failed to index file names: %v", err)
+	}
+
+	for _, m := range dataMigrations {
+		if err := runMigration(db, m); err != nil {
+			return fmt.Errorf("data migration %s failed: %v", m.name, err)
+		}
+	}
 	return nil
 }
 
+// dataMigration is a one-off update of the existing rows, recorded in schema_migrations
+// once applied. Migrations run in order before the job pool starts, and are never renamed
+// nor removed.
+type dataMigration struct {
+	name string
+	run  func(tx *gorm.DB) error
+}
+
+var dataMigrations = []dataMigration{
+	{name: "0001_backfill_storage_keys", run: backfillStorageKeys},
+	{name: "0002_backfill_blobs", run: backfillBlobs},
+	{name: "0003_reconcile_usage", run: reconcileUsage},
+	{name: "0004_backfill_token_sessions", run: backfillTokenSessions},
+}
+
+// runMigration applies m unless it was applied already. The lock serializes the instances
+// starting at the same time, the migration is recorded in the transaction that applies it.
+func runMigration(db *gorm.DB, m dataMigration) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))").Error; err != nil {
+			return err
+		}
+
+		var applied int64
+		if err := tx.Model(&models.SchemaMigration{}).Where("name = ?", m.name).Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			return nil
+		}
+
+		if err := m.run(tx); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.SchemaMigration{Name: m.name, AppliedAt: time.Now()}).Error
+	})
+}
+
+// backfillStorageKeys sets the storage key of the files uploaded before folders existed,
+// which were stored under their name
+func backfillStorageKeys(tx *gorm.DB) error {
+	return tx.Model(&models.Filesystem{}).Where("storage_key = '' OR storage_key IS NULL").Update("storage_key", gorm.Expr("name")).Error
+}
+
+// backfillTokenSessions starts a session for each refresh token issued before sessions
+// were tracked
+func backfillTokenSessions(tx *gorm.DB) error {
+	return tx.Model(&models.Token{}).Where("session_id IS NULL").Update("session_id", gorm.Expr("id")).Error
+}
+
 func getModels() []any {
 	return []any{
 		&models.User{},
 		&models.Token{},
 		&models.Filesystem{},
+		&models.Folder{},
+		&models.ShareLink{},
+		&models.ExtractionJob{},
+		&models.Upload{},
+		&models.Blob{},
+		&models.FileVersion{},
+		&models.ArchiveIndex{},
+		&models.ArchiveEntry{},
+		&models.FileTag{},
+		&models.ActionToken{},
+		&models.RecoveryCode{},
+		&models.SchemaMigration{},
 	}
 }
+
+// backfillBlobs creates the blobs of the files hashed before blobs existed. Every hash
+// keeps the object of one of its files, the other files go back to owning their object
+// and are deduplicated the next time they are hashed.
+func backfillBlobs(tx *gorm.DB) error {
+	err := tx.Exec(`
+		INSERT INTO blobs (sha256, storage_key, size, ref_count, created_at, updated_at)
+		SELECT sha256, MIN(storage_key), MAX(size), 0, NOW(), NOW()
+		FROM filesystem WHERE sha256 <> ''
+		GROUP BY sha256
+		ON CONFLICT (sha256) DO NOTHING`).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Exec(`
+		UPDATE filesystem SET sha256 = ''
+		FROM blobs
+		WHERE filesystem.sha256 = blobs.sha256 AND filesystem.storage_key <> blobs.storage_key`).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Exec(`
+		UPDATE blobs SET ref_count =
+			(SELECT COUNT(*) FROM filesystem WHERE filesystem.sha256 = blobs.sha256) +
+			(SELECT COUNT(*) FROM file_versions WHERE file_versions.sha256 = blobs.sha256)
+		WHERE ref_count = 0`).Error
+}
+
+// reconcileUsage recomputes the storage usage of every user from their files and
+// versions. Usage is kept up to date as files are stored and deleted, this catches up
+// with files stored before it was tracked.
+func reconcileUsage(tx *gorm.DB) error {
+	return tx.Exec(`
+		UPDATE users SET
+			used_bytes = COALESCE((SELECT SUM(size) FROM filesystem WHERE filesystem.user_id = users.id), 0) +
+				COALESCE((
+					SELECT SUM(file_versions.size) FROM file_versions
+					JOIN filesystem ON filesystem.id = file_versions.filesystem_id
+					WHERE filesystem.user_id = users.id
+				), 0),
+			used_files = (SELECT COUNT(*) FROM filesystem WHERE filesystem.user_id = users.id)`).Error
+}
+
+// uniqueFolderNames creates the unique index on the names of the folders in their parent.
+// Folders created twice before it existed are merged first, into the oldest one: their
+// files and subfolders are moved to it, which can make subfolders duplicates in turn.
+func uniqueFolderNames(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&models.Folder{}, models.FolderNameIndex) {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for {
+			err := tx.Exec(`
+				CREATE TEMPORARY TABLE folder_duplicates ON COMMIT DROP AS
+				SELECT id, keep_id FROM (
+					SELECT id, MIN(id) OVER (PARTITION BY user_id, COALESCE(parent_id, 0), name) AS keep_id
+					FROM folders
+				) folders WHERE id <> keep_id`).Error
+			if err != nil {
+				return err
+			}
+
+			var count int64
+			if err := tx.Table("folder_duplicates").Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				break
+			}
+
+			statements := []string{
+				`UPDATE filesystem SET folder_id = d.keep_id FROM folder_duplicates d WHERE filesystem.folder_id = d.id`,
+				`UPDATE folders SET parent_id = d.keep_id FROM folder_duplicates d WHERE folders.parent_id = d.id`,
+				`DELETE FROM folders USING folder_duplicates d WHERE folders.id = d.id`,
+				`DROP TABLE folder_duplicates`,
+			}
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Exec(`CREATE UNIQUE INDEX ` + models.FolderNameIndex + ` ON folders (user_id, COALESCE(parent_id, 0), name)`).Error
+	})
+}
+
+// uniqueFileNames creates the unique index on the names of the files outside the trash in
+// their folder. Files given the same name before it existed, which merged folders can add
+// to, are resolved first: the latest one keeps the name, the others are moved to the trash.
+func uniqueFileNames(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&models.Filesystem{}, models.FileNameIndex) {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			UPDATE filesystem SET deleted_at = NOW()
+			FROM (
+				SELECT id, MAX(id) OVER (PARTITION BY user_id, COALESCE(folder_id, 0), name) AS keep_id
+				FROM filesystem WHERE deleted_at IS NULL
+			) duplicates
+			WHERE filesystem.id = duplicates.id AND duplicates.id <> duplicates.keep_id`).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(`CREATE UNIQUE INDEX ` + models.FileNameIndex + ` ON filesystem (user_id, COALESCE(folder_id, 0), name) WHERE deleted_at IS NULL`).Error
+	})
+}
@@ -0,0 +1,11 @@
+package forms
+
+import (
+	"github.com/dbsSensei/filesystem-api/models"
+)
+
+type ArchiveEntriesResponse struct {
+	FileID  int                   `json:"file_id"`
+	Format  string                `json:"format"`
+	Entries []models.ArchiveEntry `json:"entries"`
+}
@@ -0,0 +1,37 @@
+package forms
+
+type RenameFileRequest struct {
+	Name       string `json:"name" binding:"required,max=255"`
+	OnConflict string `json:"on_conflict" binding:"omitempty,oneof=fail overwrite auto_suffix"`
+}
+
+type MoveFileRequest struct {
+	// FolderID is the destination folder, null moves the file to the root
+	FolderID   *int   `json:"folder_id"`
+	OnConflict string `json:"on_conflict" binding:"omitempty,oneof=fail overwrite auto_suffix"`
+}
+
+type CopyFileRequest struct {
+	// FolderID is the destination folder, null copies the file to the root
+	FolderID *int `json:"folder_id"`
+	// Name of the copy, the name of the file when empty
+	Name       string `json:"name" binding:"max=255"`
+	OnConflict string `json:"on_conflict" binding:"omitempty,oneof=fail overwrite auto_suffix"`
+}
+
+type DownloadBundleRequest struct {
+	// FileIDs are the files to download, their paths are kept from the root
+	FileIDs []int `json:"file_ids"`
+	// FolderID is a folder to download with everything inside it, used when FileIDs is empty
+	FolderID *int   `json:"folder_id"`
+	Format   string `json:"format" binding:"omitempty,oneof=zip tar.gz"`
+}
+
+type SetFileTagsRequest struct {
+	Tags []string `json:"tags" binding:"max=32,dive,max=64"`
+}
+
+type FileTagsResponse struct {
+	FileID int      `json:"file_id"`
+	Tags   []string `json:"tags"`
+}
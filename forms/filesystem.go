@@ -1,11 +1,44 @@
 package forms
 
 import (
+	"time"
+
 	"github.com/dbsSensei/filesystem-api/models"
 	"github.com/dbsSensei/filesystem-api/utils"
 )
 
+type GetMyFilesRequest struct {
+	Name          string     `form:"name" binding:"max=255"`
+	NameMatch     string     `form:"name_match" binding:"omitempty,oneof=prefix contains"`
+	MimeType      string     `form:"mime_type" binding:"max=255"`
+	MinSize       *int64     `form:"min_size" binding:"omitempty,min=0"`
+	MaxSize       *int64     `form:"max_size" binding:"omitempty,min=0"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	// FolderID is a folder id, or root for the files outside any folder
+	FolderID string   `form:"folder_id"`
+	Tags     []string `form:"tag"`
+
+	Sort  string `form:"sort" binding:"omitempty,oneof=name size created_at"`
+	Order string `form:"order" binding:"omitempty,oneof=asc desc"`
+	// OrderBy is kept for older clients, sort and order take precedence
+	OrderBy string `form:"order_by" binding:"omitempty,oneof=newest oldest"`
+
+	Pagination string `form:"pagination" binding:"omitempty,oneof=offset cursor"`
+	Page       int    `form:"page" binding:"omitempty,min=1"`
+	Limit      int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor     string `form:"cursor"`
+}
+
+type MyFile struct {
+	models.Filesystem
+	Tags []string `json:"tags"`
+}
+
 type GetMyFilesResponse struct {
-	Files      []models.Filesystem `json:"files"`
-	Pagination utils.Pagination    `json:"pagination"`
+	Files []MyFile `json:"files"`
+	// Pagination is set in offset pagination mode
+	Pagination *utils.Pagination `json:"pagination,omitempty"`
+	// NextCursor is set in cursor pagination mode while more files follow
+	NextCursor string `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,23 @@
+package forms
+
+import "github.com/dbsSensei/filesystem-api/models"
+
+type CreateFolderRequest struct {
+	Name     string `json:"name" binding:"required,max=255"`
+	ParentID *int   `json:"parent_id"`
+}
+
+type RenameFolderRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type MoveFolderRequest struct {
+	// ParentID is the new parent folder, null moves the folder to the root
+	ParentID *int `json:"parent_id"`
+}
+
+type FolderChildrenResponse struct {
+	Folder  *models.Folder      `json:"folder"`
+	Folders []models.Folder     `json:"folders"`
+	Files   []models.Filesystem `json:"files"`
+}
@@ -0,0 +1,21 @@
+package forms
+
+import "time"
+
+type CreateShareLinkRequest struct {
+	ExpiresIn    int    `json:"expires_in" binding:"omitempty,min=1"`
+	MaxDownloads *int   `json:"max_downloads" binding:"omitempty,min=1"`
+	Password     string `json:"password" binding:"omitempty,min=6"`
+}
+
+type ShareLinkResponse struct {
+	ID            int        `json:"id"`
+	FilesystemID  int        `json:"filesystem_id"`
+	URL           string     `json:"url"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	MaxDownloads  *int       `json:"max_downloads"`
+	DownloadCount int        `json:"download_count"`
+	HasPassword   bool       `json:"has_password"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
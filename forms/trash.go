@@ -0,0 +1,21 @@
+package forms
+
+import (
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+)
+
+type TrashedFile struct {
+	models.Filesystem
+	// PurgeAt is when the file is permanently deleted
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+type TrashResponse struct {
+	Files []TrashedFile `json:"files"`
+}
+
+type EmptyTrashResponse struct {
+	Deleted int `json:"deleted"`
+}
@@ -5,4 +5,22 @@ type WhoAmIResponse struct {
 	Name   string `json:"name"`
 	Email  string `json:"email"`
 	Status string `json:"status"`
+	Quota  Quota  `json:"quota"`
+}
+
+// Quota is the storage usage of a user and its limits, a zero limit is unlimited
+type Quota struct {
+	UsedBytes int64 `json:"used_bytes"`
+	MaxBytes  int64 `json:"max_bytes"`
+	UsedFiles int64 `json:"used_files"`
+	MaxFiles  int64 `json:"max_files"`
+}
+
+type StorageUsageResponse struct {
+	Files int64 `json:"files"`
+	// LogicalBytes is the total size of the user files and their versions
+	LogicalBytes int64 `json:"logical_bytes"`
+	// PhysicalBytes is the size of the distinct contents stored for them
+	PhysicalBytes int64 `json:"physical_bytes"`
+	SavedBytes    int64 `json:"saved_bytes"`
 }
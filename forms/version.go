@@ -0,0 +1,23 @@
+package forms
+
+import (
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+)
+
+type FileVersion struct {
+	Version int  `json:"version"`
+	Current bool `json:"current"`
+	models.FileContent
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FileVersionsResponse struct {
+	FileID   int           `json:"file_id"`
+	Versions []FileVersion `json:"versions"`
+}
+
+type PruneFileVersionsResponse struct {
+	Deleted int `json:"deleted"`
+}
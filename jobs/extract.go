@@ -0,0 +1,320 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/archive"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/storage"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"gorm.io/gorm"
+)
+
+// progressInterval is how often the progress counters of a running job are saved
+const progressInterval = time.Second
+
+// progress tracks the counters of a running job
+type progress struct {
+	job       *models.ExtractionJob
+	db        *gorm.DB
+	lastFlush time.Time
+}
+
+func (pr *progress) flush(force bool) {
+	if !force && time.Since(pr.lastFlush) < progressInterval {
+		return
+	}
+	pr.lastFlush = time.Now()
+
+	err := pr.db.Model(&models.ExtractionJob{}).Where("id = ?", pr.job.ID).Updates(map[string]any{
+		"format":            pr.job.Format,
+		"entries_processed": pr.job.EntriesProcessed,
+		"files_created":     pr.job.FilesCreated,
+		"files_updated":     pr.job.FilesUpdated,
+		"bytes_processed":   pr.job.BytesProcessed,
+	}).Error
+	if err != nil {
+		log.Printf("failed to save progress of extraction job %d: %v", pr.job.ID, err)
+	}
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// sniffLen is the number of leading bytes used to detect the content type of a file
+const sniffLen = 512
+
+// sniffer keeps the first sniffLen bytes written to it
+type sniffer struct {
+	head []byte
+}
+
+func (s *sniffer) Write(p []byte) (int, error) {
+	if remaining := sniffLen - len(s.head); remaining > 0 {
+		if len(p) < remaining {
+			remaining = len(p)
+		}
+		s.head = append(s.head, p[:remaining]...)
+	}
+	return len(p), nil
+}
+
+// mimeType detects the content type from the sniffed bytes, falling back to the
+// extension of name when the content is not recognized
+func (s *sniffer) mimeType(name string) string {
+	detected := http.DetectContentType(s.head)
+	if detected == "application/octet-stream" {
+		if byExtension := mime.TypeByExtension(path.Ext(name)); byExtension != "" {
+			return byExtension
+		}
+	}
+	return detected
+}
+
+// run extracts the archive of a claimed job and records its outcome
+func (p *Pool) run(ctx context.Context, job *models.ExtractionJob) {
+	err := p.extract(ctx, job)
+
+	now := time.Now()
+	updates := map[string]any{
+		"status":            models.JobStatusSucceeded,
+		"format":            job.Format,
+		"entries_processed": job.EntriesProcessed,
+		"files_created":     job.FilesCreated,
+		"files_updated":     job.FilesUpdated,
+		"bytes_processed":   job.BytesProcessed,
+		"error":             "",
+		"finished_at":       now,
+	}
+
+	if err != nil {
+		updates["status"] = models.JobStatusFailed
+		updates["error"] = err.Error()
+
+		var violation *archive.ViolationError
+		if errors.As(err, &violation) {
+			updates["error"] = "archive rejected: " + violation.Error()
+		}
+	}
+
+	if err := p.db.Model(&models.ExtractionJob{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("failed to finish extraction job %d: %v", job.ID, err)
+		return
+	}
+
+	// The uploaded archive is not needed anymore once its files are stored
+	if err := p.s.Storage.Delete(context.Background(), job.ArchiveKey); err != nil {
+		log.Printf("failed to delete archive of extraction job %d: %v", job.ID, err)
+	}
+}
+
+// extract stores every regular file of the job archive for its user, recreating its
+// directories as folders below the user root. When the archive is rejected or exceeds
+// the user quota part way, the files stored so far are removed. In inspect mode the
+// archive is stored as a single file along with the index of its entries.
+func (p *Pool) extract(ctx context.Context, job *models.ExtractionJob) error {
+	// Archives are read through io.ReaderAt, so spool the upload to a temporary file
+	tempFile, err := os.CreateTemp("", "extraction-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	reader, err := p.s.Storage.Get(ctx, job.ArchiveKey)
+	if err != nil {
+		return fmt.Errorf("failed to read the uploaded archive: %w", err)
+	}
+	size, err := io.Copy(tempFile, reader)
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read the uploaded archive: %w", err)
+	}
+
+	// Detect the archive format, anything else is stored as a single file. Inspected
+	// archives are stored as they are and only their entries are indexed.
+	upload := archive.Single(tempFile, size, job.ArchiveName)
+	job.Format = string(upload.Format())
+
+	var index []archive.Entry
+	var indexFormat archive.Format
+	if job.Extract || job.Inspect {
+		detected, err := archive.Open(tempFile, size)
+		if err != nil && !errors.Is(err, archive.ErrNotArchive) {
+			return err
+		}
+		if err == nil {
+			job.Format = string(detected.Format())
+			if job.Inspect {
+				if index, err = archive.Index(detected, archive.NewLimits(p.c)); err != nil {
+					return err
+				}
+				indexFormat = detected.Format()
+			} else {
+				upload = detected
+			}
+		}
+	}
+
+	pr := &progress{job: job, db: p.db}
+
+	var storageKeys, duplicateKeys []string
+	extractTransaction := func(tx *gorm.DB) error {
+		folders := make(map[string]*int)
+
+		var user models.User
+		if err := tx.Where("id = ?", job.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		quota := service.UserQuota(p.c, &user)
+
+		return upload.Walk(archive.NewLimits(p.c), func(entry archive.Entry, r io.Reader) error {
+			job.EntriesProcessed++
+			defer pr.flush(false)
+
+			if entry.IsDir {
+				_, err := service.EnsureFolderPath(tx, job.UserID, entry.Name, folders)
+				return err
+			}
+
+			folderID, err := service.EnsureFolderPath(tx, job.UserID, path.Dir(entry.Name), folders)
+			if err != nil {
+				return err
+			}
+
+			name := path.Base(entry.Name)
+			existing, err := service.FindFileByPath(tx, job.UserID, folderID, name)
+			if err != nil {
+				return err
+			}
+
+			// A new version of an existing file only adds to the stored bytes
+			var files int64 = 1
+			if existing != nil {
+				files = 0
+			}
+
+			// Give up before storing an entry that can not fit in the quota
+			if err := quota.Check(&user, entry.Size, files); err != nil {
+				return err
+			}
+
+			storageKey := storage.NewKey("", job.UserID)
+
+			// Store the file in the storage backend, hashing, sniffing and counting
+			// its content in the same pass
+			hash := sha256.New()
+			sniff := &sniffer{}
+			var size int64
+			tee := io.TeeReader(r, io.MultiWriter(hash, sniff))
+			counter := &countingReader{r: &countingReader{r: tee, n: &size}, n: &job.BytesProcessed}
+			if err := p.s.Storage.Put(ctx, storageKey, counter, entry.Size); err != nil {
+				return err
+			}
+			storageKeys = append(storageKeys, storageKey)
+
+			// Charge the stored size, rolling the whole upload back when it exceeds the quota
+			if err := service.ChargeUsage(tx, job.UserID, quota, size, files); err != nil {
+				return err
+			}
+			user.UsedBytes += size
+			user.UsedFiles += files
+
+			// Point the file to the blob already holding the same content, if any
+			sum := hex.EncodeToString(hash.Sum(nil))
+			blobKey, err := service.AcquireBlob(tx, sum, storageKey, size)
+			if err != nil {
+				return err
+			}
+			if blobKey != storageKey {
+				duplicateKeys = append(duplicateKeys, storageKey)
+			}
+
+			if indexFormat != "" {
+				if err := service.SaveArchiveIndex(tx, sum, indexFormat, index); err != nil {
+					return err
+				}
+			}
+
+			content := models.FileContent{
+				StorageKey:   blobKey,
+				Sha256:       sum,
+				Size:         size,
+				MimeType:     sniff.mimeType(entry.Name),
+				OriginalPath: entry.Name,
+			}
+			if upload.Format() != archive.FormatFile {
+				mode, modTime := entry.Mode, entry.ModTime
+				content.SourceArchiveID = &job.ID
+				content.Mode = &mode
+				if !modTime.IsZero() {
+					content.ModTime = &modTime
+				}
+			}
+
+			if existing != nil {
+				if err := service.PushVersion(tx, existing); err != nil {
+					return err
+				}
+				existing.FileContent = content
+				if err := tx.Save(existing).Error; err != nil {
+					return err
+				}
+
+				job.FilesUpdated++
+				return nil
+			}
+
+			_, err = p.s.FilesystemService.Create(&models.Filesystem{
+				UserID:      job.UserID,
+				FolderID:    folderID,
+				Name:        name,
+				Version:     1,
+				FileContent: content,
+			}, tx)
+			if err != nil {
+				return service.FileNameError(err)
+			}
+
+			job.FilesCreated++
+			return nil
+		})
+	}
+
+	if err := utils.Transaction(p.db, extractTransaction); err != nil {
+		for _, storageKey := range storageKeys {
+			_ = p.s.Storage.Delete(context.Background(), storageKey)
+		}
+		job.FilesCreated = 0
+		job.FilesUpdated = 0
+		return err
+	}
+
+	// The content of duplicates is kept by their blob
+	for _, storageKey := range duplicateKeys {
+		_ = p.s.Storage.Delete(context.Background(), storageKey)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnifferMimeType(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filename string
+		content  []byte
+		expected string
+	}{
+		{
+			name:     "PNG",
+			filename: "image.bin",
+			content:  append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 1024)...),
+			expected: "image/png",
+		},
+		{
+			name:     "Text",
+			filename: "notes",
+			content:  []byte(strings.Repeat("hello ", 200)),
+			expected: "text/plain; charset=utf-8",
+		},
+		{
+			name:     "ExtensionFallback",
+			filename: "dir/data.json",
+			content:  []byte{0x00, 0x01, 0x02},
+			expected: "application/json",
+		},
+		{
+			name:     "Unknown",
+			filename: "blob",
+			content:  []byte{0x00, 0x01, 0x02},
+			expected: "application/octet-stream",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sniff := &sniffer{}
+			_, err := io.Copy(io.Discard, io.TeeReader(bytes.NewReader(tc.content), sniff))
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(sniff.head), sniffLen)
+			require.Equal(t, tc.expected, sniff.mimeType(tc.filename))
+		})
+	}
+}
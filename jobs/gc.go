@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/storage"
+)
+
+// gcBatchSize is the number of unreferenced blobs removed per transaction
+const gcBatchSize = 100
+
+// collect removes the blobs no longer referenced by any file every BlobGCInterval,
+// until ctx is cancelled
+func (p *Pool) collect(ctx context.Context) {
+	ticker := time.NewTicker(p.c.BlobGCInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.CollectBlobs(ctx); err != nil {
+			log.Printf("failed to collect blobs: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CollectBlobs deletes the blobs whose reference count dropped to zero along with
+// their stored content, and returns how many were removed
+func (p *Pool) CollectBlobs(ctx context.Context) (int, error) {
+	removed := 0
+
+	for {
+		// A concurrent upload of the same content waits for the rows being deleted
+		// and then creates a new blob, so the content is only deleted once the rows are gone.
+		// Archive indexes go away with their blob in the same statement.
+		var blobs []models.Blob
+		err := p.db.Raw(`
+			WITH removed AS (
+				DELETE FROM blobs WHERE sha256 IN (
+					SELECT sha256 FROM blobs WHERE ref_count <= 0
+					ORDER BY sha256 FOR UPDATE SKIP LOCKED LIMIT ?
+				)
+				RETURNING *
+			), removed_entries AS (
+				DELETE FROM archive_entries WHERE sha256 IN (SELECT sha256 FROM removed)
+			), removed_indexes AS (
+				DELETE FROM archive_indexes WHERE sha256 IN (SELECT sha256 FROM removed)
+			)
+			SELECT * FROM removed`, gcBatchSize).Scan(&blobs).Error
+		if err != nil {
+			return removed, err
+		}
+
+		for _, blob := range blobs {
+			err := p.s.Storage.Delete(ctx, blob.StorageKey)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				log.Printf("failed to delete the content of blob %s: %v", blob.Sha256, err)
+			}
+		}
+
+		removed += len(blobs)
+		if len(blobs) < gcBatchSize {
+			return removed, nil
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/storage"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// hashBatchSize is the number of unhashed contents looked up at once
+const hashBatchSize = 50
+
+// legacyContent is the content of a file or version stored before content hashes were recorded
+type legacyContent struct {
+	ID         int
+	UserID     int
+	StorageKey string
+	Size       int64
+}
+
+// backfillHashes hashes the contents stored before content hashes were recorded, once
+// when the pool starts
+func (p *Pool) backfillHashes(ctx context.Context) {
+	hashed, err := p.HashLegacyContents(ctx)
+	if err != nil {
+		log.Printf("failed to hash legacy contents: %v", err)
+	}
+	if hashed > 0 {
+		log.Printf("hashed %d contents stored before content hashes were recorded", hashed)
+	}
+}
+
+// HashLegacyContents hashes the files and versions stored before content hashes were
+// recorded and links them to the blob of their content, and returns how many were
+// hashed. Contents whose object is missing from the storage are skipped.
+func (p *Pool) HashLegacyContents(ctx context.Context) (int, error) {
+	files, err := p.hashContents(ctx, "filesystem", func(lastID int) *gorm.DB {
+		return p.db.Table("filesystem").
+			Select("id, user_id, storage_key, size").
+			Where("sha256 = '' AND id > ?", lastID)
+	})
+	if err != nil {
+		return files, err
+	}
+
+	versions, err := p.hashContents(ctx, "file_versions", func(lastID int) *gorm.DB {
+		return p.db.Table("file_versions").
+			Select("file_versions.id, filesystem.user_id, file_versions.storage_key, file_versions.size").
+			Joins("JOIN filesystem ON filesystem.id = file_versions.filesystem_id").
+			Where("file_versions.sha256 = '' AND file_versions.id > ?", lastID)
+	})
+	return files + versions, err
+}
+
+// hashContents hashes the unhashed contents of table selected by query, in id order
+func (p *Pool) hashContents(ctx context.Context, table string, query func(lastID int) *gorm.DB) (int, error) {
+	hashed, lastID := 0, 0
+	for {
+		var contents []legacyContent
+		if err := query(lastID).Order(table + ".id").Limit(hashBatchSize).Scan(&contents).Error; err != nil {
+			return hashed, err
+		}
+
+		for _, content := range contents {
+			lastID = content.ID
+			ok, err := p.hashContent(ctx, table, content)
+			if err != nil {
+				return hashed, err
+			}
+			if ok {
+				hashed++
+			}
+		}
+
+		if len(contents) < hashBatchSize || ctx.Err() != nil {
+			return hashed, ctx.Err()
+		}
+	}
+}
+
+// hashContent hashes a content and links it to its blob. The object is read outside of
+// the transaction, the row is only updated if it still points to the hashed object.
+func (p *Pool) hashContent(ctx context.Context, table string, content legacyContent) (bool, error) {
+	reader, err := p.s.Storage.Get(ctx, content.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	reader.Close()
+	if err != nil {
+		return false, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	var staleKey string
+	linked := false
+	linkTransaction := func(tx *gorm.DB) error {
+		var current models.FileContent
+		err := tx.Table(table).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("storage_key, sha256, size").
+			Where("id = ?", content.ID).
+			Scan(&current).Error
+		if err != nil {
+			return err
+		}
+		if current.Sha256 != "" || current.StorageKey != content.StorageKey {
+			return nil
+		}
+
+		staleKey, err = service.LinkContent(tx, content.UserID, &current, sum, size)
+		if err != nil {
+			return err
+		}
+
+		// UpdateColumns keeps updated_at, which is served as Last-Modified
+		linked = true
+		return tx.Table(table).Where("id = ?", content.ID).UpdateColumns(map[string]any{
+			"sha256":      current.Sha256,
+			"storage_key": current.StorageKey,
+			"size":        current.Size,
+		}).Error
+	}
+
+	if err := utils.Transaction(p.db, linkTransaction); err != nil {
+		return false, err
+	}
+
+	// The content was already stored in a blob
+	if staleKey != "" {
+		_ = p.s.Storage.Delete(context.Background(), staleKey)
+	}
+
+	return linked, nil
+}
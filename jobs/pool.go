@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/config"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"gorm.io/gorm"
+)
+
+// Pool runs extraction jobs, the trash purger, the blob garbage collector and the hashing of
+// legacy contents in the background. Jobs are claimed from the database,
+// so jobs queued before a restart are picked up again once the pool starts.
+type Pool struct {
+	c  *config.Config
+	db *gorm.DB
+	s  *service.Services
+}
+
+// NewPool creates a new Pool
+func NewPool(c *config.Config, db *gorm.DB, s *service.Services) *Pool {
+	return &Pool{
+		c:  c,
+		db: db,
+		s:  s,
+	}
+}
+
+// Start requeues the jobs interrupted by a previous shutdown and starts the workers,
+// they stop when ctx is cancelled
+func (p *Pool) Start(ctx context.Context) error {
+	// A single API instance runs the workers, so running jobs can only be
+	// leftovers of a process that stopped before finishing them
+	err := p.db.Model(&models.ExtractionJob{}).
+		Where("status = ?", models.JobStatusRunning).
+		Updates(map[string]any{"status": models.JobStatusQueued, "started_at": nil}).Error
+	if err != nil {
+		return err
+	}
+
+	workers := p.c.JobWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
+		go p.work(ctx)
+	}
+	go p.collect(ctx)
+	go p.purge(ctx)
+	go p.backfillHashes(ctx)
+
+	return nil
+}
+
+// work claims and runs queued jobs until ctx is cancelled
+func (p *Pool) work(ctx context.Context) {
+	ticker := time.NewTicker(p.c.JobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before waiting for the next tick
+		for {
+			job, err := p.claim()
+			if err != nil {
+				log.Printf("failed to claim extraction job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+
+			p.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim marks the oldest queued job as running and returns it, nil when the queue is empty
+func (p *Pool) claim() (*models.ExtractionJob, error) {
+	var job models.ExtractionJob
+	err := p.db.Raw(`
+		UPDATE extraction_jobs SET status = ?, started_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM extraction_jobs WHERE status = ?
+			ORDER BY id FOR UPDATE SKIP LOCKED LIMIT 1
+		)
+		RETURNING *`, models.JobStatusRunning, models.JobStatusQueued).Scan(&job).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if job.ID == 0 {
+		return nil, nil
+	}
+	return &job, nil
+}
@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// purgeBatchSize is the number of trashed files permanently deleted per transaction
+const purgeBatchSize = 100
+
+// purge permanently deletes the files trashed for longer than TrashRetention and the
+// expired resumable uploads every TrashPurgeInterval, until ctx is cancelled
+func (p *Pool) purge(ctx context.Context) {
+	ticker := time.NewTicker(p.c.TrashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.PurgeTrash(ctx); err != nil {
+			log.Printf("failed to purge the trash: %v", err)
+		}
+		if _, err := p.PurgeExpiredUploads(ctx); err != nil {
+			log.Printf("failed to purge expired uploads: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeTrash permanently deletes the files trashed for longer than TrashRetention
+// with their versions, and returns how many were deleted. Their contents are removed
+// by the blob garbage collector.
+func (p *Pool) PurgeTrash(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-p.c.TrashRetention)
+	purged := 0
+
+	for {
+		var files []models.Filesystem
+		var storageKeys []string
+		purgeTransaction := func(tx *gorm.DB) error {
+			err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("deleted_at < ?", cutoff).
+				Order("id").
+				Limit(purgeBatchSize).
+				Find(&files).Error
+			if err != nil {
+				return err
+			}
+
+			byUser := make(map[int][]models.Filesystem)
+			for _, file := range files {
+				byUser[file.UserID] = append(byUser[file.UserID], file)
+			}
+
+			for userID, userFiles := range byUser {
+				keys, err := service.DeleteFiles(tx, userID, userFiles)
+				if err != nil {
+					return err
+				}
+				storageKeys = append(storageKeys, keys...)
+			}
+			return nil
+		}
+
+		if err := utils.Transaction(p.db, purgeTransaction); err != nil {
+			return purged, err
+		}
+
+		// Files stored before blobs existed own their content
+		for _, key := range storageKeys {
+			_ = p.s.Storage.Delete(ctx, key)
+		}
+
+		purged += len(files)
+		if len(files) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
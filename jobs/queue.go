@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/storage"
+)
+
+// Enqueue persists an uploaded file in the storage and queues its extraction,
+// extract false stores archives as a single file and inspect stores them as a
+// single file whose entries can be browsed
+func Enqueue(ctx context.Context, s *service.Services, userID int, filename string, r io.Reader, size int64, extract bool, inspect bool) (*models.ExtractionJob, error) {
+	archiveKey := storage.NewKey("archives/", userID)
+	if err := s.Storage.Put(ctx, archiveKey, r, size); err != nil {
+		return nil, fmt.Errorf("failed to save the file: %w", err)
+	}
+
+	job := &models.ExtractionJob{
+		UserID:      userID,
+		ArchiveName: filename,
+		ArchiveKey:  archiveKey,
+		ArchiveSize: size,
+		Extract:     extract && !inspect,
+		Inspect:     inspect,
+		Status:      models.JobStatusQueued,
+	}
+	if _, err := s.ExtractionJobService.Create(job, nil); err != nil {
+		_ = s.Storage.Delete(context.Background(), archiveKey)
+		return nil, err
+	}
+
+	return job, nil
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+)
+
+// PurgeExpiredUploads deletes the resumable uploads that received no chunk for
+// TusUploadExpiry with the bytes staged for them, and returns how many were deleted
+func (p *Pool) PurgeExpiredUploads(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-p.c.TusUploadExpiry)
+
+	var uploads []models.Upload
+	err := p.db.WithContext(ctx).
+		Where("job_id IS NULL AND updated_at < ?", cutoff).
+		Find(&uploads).Error
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, upload := range uploads {
+		// Uploads resumed or completed in the meantime are kept
+		result := p.db.WithContext(ctx).
+			Where("id = ? AND job_id IS NULL AND updated_at < ?", upload.ID, cutoff).
+			Delete(&models.Upload{})
+		if result.Error != nil {
+			return purged, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		_ = os.Remove(filepath.Join(p.c.TusUploadPath, upload.ID.String()))
+		purged++
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer writes emails to a file instead of sending them, or to the log when no
+// path is set. It is meant for local development.
+type LogMailer struct {
+	mu   sync.Mutex
+	from string
+	path string
+}
+
+// NewLogMailer creates a mailer writing the emails to path
+func NewLogMailer(from string, path string) *LogMailer {
+	return &LogMailer{from: from, path: path}
+}
+
+func (m *LogMailer) Send(_ context.Context, message Message) error {
+	data, err := format(m.from, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if m.path == "" {
+		log.Printf("email to %s:\n%s", message.To, data)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, "\r\n\r\n"...)); err != nil {
+		return err
+	}
+	return file.Close()
+}
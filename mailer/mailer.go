@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/config"
+)
+
+// Names of the mailers that can be selected in the config
+const (
+	BackendSMTP = "smtp"
+	BackendLog  = "log"
+)
+
+// ErrInvalidHeader is returned when a header of a message would span several lines
+var ErrInvalidHeader = errors.New("mail header contains a line break")
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is an interface for sending emails
+type Mailer interface {
+	// Send delivers the message, from the sender configured for the mailer
+	Send(ctx context.Context, message Message) error
+}
+
+// New creates the mailer selected in the config
+func New(c *config.Config) (Mailer, error) {
+	switch c.MailerBackend {
+	case BackendLog, "":
+		return NewLogMailer(c.MailerFrom, c.MailerLogPath), nil
+	case BackendSMTP:
+		return NewSMTPMailer(c)
+	default:
+		return nil, fmt.Errorf("unsupported mailer backend %q", c.MailerBackend)
+	}
+}
+
+// format renders the message with its headers, as sent over SMTP
+func format(from string, message Message, date time.Time) ([]byte, error) {
+	for _, header := range []string{from, message.To, message.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + message.To + "\r\n")
+	sb.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	sb.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	sb.WriteString("\r\n")
+
+	// SMTP requires CRLF line endings
+	body := strings.ReplaceAll(message.Body, "\r\n", "\n")
+	sb.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return []byte(sb.String()), nil
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	data, err := format("noreply@example.com", Message{
+		To:      "user@example.com",
+		Subject: "Vérifiez votre email",
+		Body:    "line 1\nline 2",
+	}, date)
+	require.NoError(t, err)
+
+	message := string(data)
+	require.Contains(t, message, "From: noreply@example.com\r\n")
+	require.Contains(t, message, "To: user@example.com\r\n")
+	require.Contains(t, message, "Subject: =?utf-8?q?V=C3=A9rifiez_votre_email?=\r\n")
+	require.Contains(t, message, "Date: Sat, 01 Jul 2023 12:00:00 +0000\r\n")
+	require.True(t, strings.HasSuffix(message, "\r\n\r\nline 1\r\nline 2"))
+
+	_, err = format("noreply@example.com", Message{To: "user@example.com\r\nBcc: victim@example.com"}, date)
+	require.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestLogMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	mailer := NewLogMailer("noreply@example.com", path)
+
+	err := mailer.Send(context.Background(), Message{To: "a@example.com", Subject: "first", Body: "hello"})
+	require.NoError(t, err)
+	err = mailer.Send(context.Background(), Message{To: "b@example.com", Subject: "second", Body: "world"})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "To: a@example.com")
+	require.Contains(t, string(data), "To: b@example.com")
+	require.Contains(t, string(data), "world")
+}
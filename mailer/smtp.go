@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/config"
+)
+
+// SMTPMailer sends emails through an SMTP server, authenticating when a username is set
+type SMTPMailer struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates a mailer sending through the SMTP server of the config
+func NewSMTPMailer(c *config.Config) (*SMTPMailer, error) {
+	if c.SMTPHost == "" || c.MailerFrom == "" {
+		return nil, errors.New("SMTP_HOST and MAILER_FROM are required by the smtp mailer")
+	}
+
+	m := &SMTPMailer{
+		addr: net.JoinHostPort(c.SMTPHost, strconv.Itoa(c.SMTPPort)),
+		host: c.SMTPHost,
+		from: c.MailerFrom,
+	}
+	if c.SMTPUsername != "" {
+		m.auth = smtp.PlainAuth("", c.SMTPUsername, c.SMTPPassword, c.SMTPHost)
+	}
+
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	data, err := format(m.from, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// net/smtp does not take a context, only give up before dialing
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{message.To}, data)
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"github.com/dbsSensei/filesystem-api/config"
 	"github.com/dbsSensei/filesystem-api/database"
+	"github.com/dbsSensei/filesystem-api/jobs"
+	"github.com/dbsSensei/filesystem-api/mailer"
 	"github.com/dbsSensei/filesystem-api/server"
 	"github.com/dbsSensei/filesystem-api/service"
+	"github.com/dbsSensei/filesystem-api/storage"
 )
 
 func main() {
@@ -20,8 +24,26 @@ func main() {
 		panic(err)
 	}
 
+	// Initialize storage
+	store, err := storage.New(c)
+	if err != nil {
+		panic(err)
+	}
+
+	// Initialize mailer
+	mail, err := mailer.New(c)
+	if err != nil {
+		panic(err)
+	}
+
 	// Initialize service
-	s := service.Init(db)
+	s := service.Init(db, store, mail)
+
+	// Start background jobs
+	err = jobs.NewPool(c, db, s).Start(context.Background())
+	if err != nil {
+		panic(err)
+	}
 
 	//	Initialize server
 	err = server.Init(c, db, s)
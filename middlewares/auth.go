@@ -3,6 +3,7 @@ package middlewares
 import (
 	"errors"
 	"fmt"
+	"github.com/dbsSensei/filesystem-api/service"
 	"github.com/dbsSensei/filesystem-api/utils"
 	"net/http"
 	"strings"
@@ -16,8 +17,8 @@ const (
 	authorizationPayloadKey = "authorization_payload"
 )
 
-// AuthMiddleware creates a gin middleware for authorization
-func AuthMiddleware(tokenMaker utils.TokenMaker) gin.HandlerFunc {
+// AuthMiddleware creates a gin middleware for authorization, access tokens of a revoked session are rejected
+func AuthMiddleware(tokenMaker utils.TokenMaker, sessionStore service.SessionStore) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
 
@@ -28,31 +29,45 @@ func AuthMiddleware(tokenMaker utils.TokenMaker) gin.HandlerFunc {
 			return
 		}
 
-		var accessToken string
-		fields := strings.Fields(authorizationHeader)
-		//if len(fields) < 2 {
-		//	err := errors.New("invalid authorization header format")
-		//	ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ResponseData("error", err.Error(), nil))
-		//	 return
-		//}
+		// The token is sent either alone or after its type, as in "Bearer <token>"
+		accessToken := authorizationHeader
+		if authorizationType, token, found := strings.Cut(authorizationHeader, " "); found {
+			token = strings.TrimSpace(token)
+			if authorizationType == "" || token == "" {
+				err := errors.New("invalid authorization header format")
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ResponseData("error", err.Error(), nil))
+				return
+			}
 
-		if len(fields) > 1 {
-			authorizationType := strings.ToLower(fields[0])
+			authorizationType = strings.ToLower(authorizationType)
 			if authorizationType != authorizationTypeBearer {
 				err := fmt.Errorf("unsupported authorization type %s", authorizationType)
 				ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ResponseData("error", err.Error(), nil))
 				return
 			}
 
-			accessToken = fields[1]
+			accessToken = token
 		}
 
-		if len(fields) == 1 {
-			accessToken = fields[0]
+		payload, err := tokenMaker.VerifyToken(accessToken)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ResponseData("error", err.Error(), nil))
+			return
 		}
 
-		payload, err := tokenMaker.VerifyToken(accessToken)
+		// Refresh tokens are signed with the same key and live longer, they only refresh a session
+		if payload.Type != utils.TokenTypeAccess {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ResponseData("error", utils.ErrInvalidToken.Error(), nil))
+			return
+		}
+
+		revoked, err := sessionStore.IsSessionRevoked(ctx.Request.Context(), payload.SessionId)
 		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, utils.ResponseData("error", err.Error(), nil))
+			return
+		}
+		if revoked {
+			err := errors.New("session has been revoked")
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ResponseData("error", err.Error(), nil))
 			return
 		}
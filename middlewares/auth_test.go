@@ -1,26 +1,51 @@
 package middlewares
 
 import (
+	"context"
 	"fmt"
 	"github.com/dbsSensei/filesystem-api/utils"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 )
 
+// revokedSessions is a session store holding the revoked sessions
+type revokedSessions map[uuid.UUID]bool
+
+func (r revokedSessions) IsSessionRevoked(_ context.Context, sessionID uuid.UUID) (bool, error) {
+	return r[sessionID], nil
+}
+
+var revokedSessionId = uuid.New()
+
 func addAuthorization(
 	t *testing.T,
 	request *http.Request,
 	tokenMaker utils.TokenMaker,
 	authorizationType string,
-	userId int32,
+	userId int,
 	duration time.Duration,
 ) {
-	token, payload, err := tokenMaker.CreateToken(userId, duration)
+	addSessionAuthorization(t, request, tokenMaker, authorizationType, userId, uuid.New(), utils.TokenTypeAccess, duration)
+}
+
+func addSessionAuthorization(
+	t *testing.T,
+	request *http.Request,
+	tokenMaker utils.TokenMaker,
+	authorizationType string,
+	userId int,
+	sessionId uuid.UUID,
+	tokenType utils.TokenType,
+	duration time.Duration,
+) {
+	token, payload, err := tokenMaker.CreateToken(userId, sessionId, tokenType, duration)
 	require.NoError(t, err)
 	require.NotEmpty(t, payload)
 
@@ -69,6 +94,34 @@ func TestAuthMiddleware(t *testing.T) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
 			},
 		},
+		{
+			name: "BareToken",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker utils.TokenMaker) {
+				addAuthorization(t, request, tokenMaker, "", 1, time.Minute)
+				request.Header.Set(authorizationHeaderKey, strings.TrimSpace(request.Header.Get(authorizationHeaderKey)))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "RevokedSession",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker utils.TokenMaker) {
+				addSessionAuthorization(t, request, tokenMaker, authorizationTypeBearer, 1, revokedSessionId, utils.TokenTypeAccess, time.Minute)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "RefreshToken",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker utils.TokenMaker) {
+				addSessionAuthorization(t, request, tokenMaker, authorizationTypeBearer, 1, uuid.New(), utils.TokenTypeRefresh, time.Minute)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
 		{
 			name: "ExpiredToken",
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker utils.TokenMaker) {
@@ -88,7 +141,7 @@ func TestAuthMiddleware(t *testing.T) {
 			authPath := "/auth"
 			server.router.GET(
 				authPath,
-				AuthMiddleware(server.tokenMaker),
+				AuthMiddleware(server.tokenMaker, revokedSessions{revokedSessionId: true}),
 				func(ctx *gin.Context) {
 					ctx.JSON(http.StatusOK, gin.H{})
 				},
@@ -23,7 +23,7 @@ type Server struct {
 
 func (server *Server) setupRouter() {
 	r := gin.Default()
-	authorized := r.Group("/").Use(AuthMiddleware(server.tokenMaker))
+	authorized := r.Group("/").Use(AuthMiddleware(server.tokenMaker, revokedSessions{}))
 	authorized.GET("/", func(context *gin.Context) {
 
 	})
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+type ActionTokenPurpose string
+
+const (
+	ActionTokenVerifyEmail   ActionTokenPurpose = "verify_email"
+	ActionTokenResetPassword ActionTokenPurpose = "reset_password"
+	ActionTokenMFAChallenge  ActionTokenPurpose = "mfa_challenge"
+)
+
+// ActionToken is a single-use token handed to a user to confirm an action, by email or
+// as the challenge of a two-step signin. Only the SHA-256 of the token is stored, UsedAt
+// is set once it has been consumed. Attempts counts the failed confirmations.
+type ActionToken struct {
+	ID        int                `json:"id" gorm:"primarykey"`
+	UserID    int                `json:"user_id" gorm:"not null;index"`
+	Purpose   ActionTokenPurpose `json:"purpose" gorm:"not null"`
+	TokenHash string             `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time          `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time         `json:"used_at"`
+	Attempts  int                `json:"attempts" gorm:"not null;default:0"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+func (t *ActionToken) TableName() string {
+	return "action_tokens"
+}
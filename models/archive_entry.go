@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// ArchiveIndex records that the entries of an archive stored as a single file
+// were indexed. Indexes are keyed by the SHA-256 of the archive, so every file
+// and version with the same content shares them.
+type ArchiveIndex struct {
+	Sha256  string `json:"sha256" gorm:"primarykey"`
+	Format  string `json:"format" gorm:"not null"`
+	Entries int    `json:"entries" gorm:"not null;default:0"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (i *ArchiveIndex) TableName() string {
+	return "archive_indexes"
+}
+
+// ArchiveEntry is a file or directory inside an indexed archive. Offset is where
+// the content of the file starts in the decompressed tar stream or in the zip
+// file, -1 when unknown.
+type ArchiveEntry struct {
+	ID      int        `json:"-" gorm:"primarykey"`
+	Sha256  string     `json:"-" gorm:"not null;uniqueIndex:idx_archive_entries_path"`
+	Path    string     `json:"path" gorm:"not null;uniqueIndex:idx_archive_entries_path"`
+	Size    int64      `json:"size" gorm:"not null;default:0"`
+	Mode    int64      `json:"mode" gorm:"not null;default:0"`
+	ModTime *time.Time `json:"mod_time"`
+	IsDir   bool       `json:"is_dir" gorm:"not null;default:false"`
+	Offset  int64      `json:"-" gorm:"not null"`
+}
+
+func (e *ArchiveEntry) TableName() string {
+	return "archive_entries"
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// Blob is a stored file content, shared by every file with the same SHA-256.
+// RefCount is the number of files pointing to it, blobs no longer referenced
+// are removed by the garbage collector.
+type Blob struct {
+	Sha256     string `json:"sha256" gorm:"primarykey"`
+	StorageKey string `json:"-" gorm:"not null"`
+	Size       int64  `json:"size" gorm:"not null"`
+	RefCount   int64  `json:"ref_count" gorm:"not null;default:0;index"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (b *Blob) TableName() string {
+	return "blobs"
+}
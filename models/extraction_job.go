@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+type ExtractionJob struct {
+	ID          int       `json:"id" gorm:"primarykey"`
+	UserID      int       `json:"user_id" gorm:"not null;index"`
+	ArchiveName string    `json:"archive_name" gorm:"not null"`
+	ArchiveKey  string    `json:"-" gorm:"not null"`
+	ArchiveSize int64     `json:"archive_size" gorm:"not null"`
+	Extract     bool      `json:"extract" gorm:"not null;default:true"`
+	Inspect     bool      `json:"inspect" gorm:"not null;default:false"`
+	Format      string    `json:"format"`
+	Status      JobStatus `json:"status" gorm:"not null;index"`
+
+	EntriesProcessed int    `json:"entries_processed" gorm:"not null;default:0"`
+	FilesCreated     int    `json:"files_created" gorm:"not null;default:0"`
+	FilesUpdated     int    `json:"files_updated" gorm:"not null;default:0"`
+	BytesProcessed   int64  `json:"bytes_processed" gorm:"not null;default:0"`
+	Error            string `json:"error"`
+
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func (j *ExtractionJob) TableName() string {
+	return "extraction_jobs"
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// FileTag is a label attached to a file, listings can be filtered on it
+type FileTag struct {
+	ID           int    `json:"-" gorm:"primarykey"`
+	FilesystemID int    `json:"filesystem_id" gorm:"not null;uniqueIndex:idx_file_tags_name"`
+	Name         string `json:"name" gorm:"not null;uniqueIndex:idx_file_tags_name;index"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (t *FileTag) TableName() string {
+	return "file_tags"
+}
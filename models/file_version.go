@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// FileVersion is an immutable previous version of a file
+type FileVersion struct {
+	ID           int `json:"id" gorm:"primarykey"`
+	FilesystemID int `json:"filesystem_id" gorm:"not null;uniqueIndex:idx_file_versions_version"`
+	Version      int `json:"version" gorm:"not null;uniqueIndex:idx_file_versions_version"`
+	FileContent
+
+	// CreatedAt is when the content of the version was stored
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (v *FileVersion) TableName() string {
+	return "file_versions"
+}
@@ -1,15 +1,46 @@
 package models
 
 import (
+	"gorm.io/gorm"
 	"time"
 )
 
+// FileContent describes a stored content of a file, shared by the file and its versions
+type FileContent struct {
+	StorageKey string `json:"-"`
+	Sha256     string `json:"sha256"`
+	Size       int64  `json:"size" gorm:"not null;default:0"`
+	MimeType   string `json:"mime_type"`
+
+	// OriginalPath is the path of the file inside the uploaded archive, or the
+	// uploaded filename when it was stored as it is
+	OriginalPath string `json:"original_path"`
+	// SourceArchiveID is the extraction job of the archive the file came from
+	SourceArchiveID *int `json:"source_archive_id" gorm:"index"`
+	// Mode and ModTime are the permissions and modification time recorded in the archive
+	Mode    *int64     `json:"mode"`
+	ModTime *time.Time `json:"mod_time"`
+}
+
+// FileNameIndex is the unique index on the name of a file outside the trash in its folder,
+// created with the migrations since files at the root have no folder to compare
+const FileNameIndex = "idx_filesystem_user_folder_name"
+
+// Filesystem is a file of a user, identified by its folder and name. It holds the
+// content of its latest version, the previous ones are kept as FileVersion. Deleted
+// files stay in the trash until they are restored or purged.
 type Filesystem struct {
-	ID        int    `json:"id" gorm:"primarykey"`
-	UserID    int    `json:"user_id"`
-	Name      string `json:"name"`
+	ID       int    `json:"id" gorm:"primarykey"`
+	UserID   int    `json:"user_id"`
+	FolderID *int   `json:"folder_id" gorm:"index"`
+	Name     string `json:"name"`
+	Version  int    `json:"version" gorm:"not null;default:1"`
+	FileContent
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	// DeletedAt is set while the file is in the trash
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index" swaggertype:"string" format:"date-time"`
 }
 
 func (t *Filesystem) TableName() string {
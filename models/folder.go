@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// FolderNameIndex is the unique index on the name of a folder in its parent, created
+// with the migrations since roots have no parent to compare
+const FolderNameIndex = "idx_folders_user_parent_name"
+
+type Folder struct {
+	ID       int    `json:"id" gorm:"primarykey"`
+	UserID   int    `json:"user_id" gorm:"not null;index"`
+	ParentID *int   `json:"parent_id" gorm:"index"`
+	Name     string `json:"name" gorm:"not null"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (f *Folder) TableName() string {
+	return "folders"
+}
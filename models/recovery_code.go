@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode is a one-time code a user can sign in with instead of a TOTP code, when
+// they lost their device. Only the SHA-256 of the code is stored.
+type RecoveryCode struct {
+	ID        int        `json:"id" gorm:"primarykey"`
+	UserID    int        `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (r *RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// SchemaMigration records a data migration that has been applied, so it only runs once
+type SchemaMigration struct {
+	Name      string    `json:"name" gorm:"primarykey"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func (m *SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+type ShareLink struct {
+	ID            int        `json:"id" gorm:"primarykey"`
+	UserID        int        `json:"user_id" gorm:"not null;index"`
+	FilesystemID  int        `json:"filesystem_id" gorm:"not null;index"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null"`
+	MaxDownloads  *int       `json:"max_downloads"`
+	DownloadCount int        `json:"download_count" gorm:"not null;default:0"`
+	PasswordHash  string     `json:"-"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (s *ShareLink) TableName() string {
+	return "share_links"
+}
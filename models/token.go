@@ -5,13 +5,19 @@ import (
 	"time"
 )
 
+// Token is a refresh token. Every refresh rotates it into a new token of the same
+// session, RotatedAt is set once it has been exchanged and it can not be used again.
 type Token struct {
-	ID           uuid.UUID `json:"id" gorm:"primarykey"`
-	UserID       int       `json:"user_id"`
-	RefreshToken string    `gorm:"size:2048" json:"refresh_token"`
-	PlatformID   int       `gorm:"not null" json:"platform_id"`
-	IsBlocked    bool      `gorm:"not null;default:false" json:"is_blocked"`
-	ExpiresAt    time.Time `gorm:"not null" json:"expires_at"`
+	ID           uuid.UUID  `json:"id" gorm:"primarykey"`
+	UserID       int        `json:"user_id"`
+	SessionID    uuid.UUID  `gorm:"type:uuid;index" json:"session_id"`
+	RefreshToken string     `gorm:"size:2048" json:"refresh_token"`
+	PlatformID   int        `gorm:"not null" json:"platform_id"`
+	IsBlocked    bool       `gorm:"not null;default:false" json:"is_blocked"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	RotatedAt    *time.Time `json:"rotated_at"`
+	ClientIP     string     `gorm:"size:64" json:"client_ip"`
+	UserAgent    string     `gorm:"size:512" json:"user_agent"`
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type Upload struct {
+	ID       uuid.UUID `json:"id" gorm:"primarykey"`
+	UserID   int       `json:"user_id" gorm:"not null;index"`
+	Length   int64     `json:"length" gorm:"not null"`
+	Offset   int64     `json:"offset" gorm:"not null;default:0"`
+	Filename string    `json:"filename" gorm:"not null"`
+	Metadata string    `json:"metadata"`
+	Extract  bool      `json:"extract" gorm:"not null;default:true"`
+	Inspect  bool      `json:"inspect" gorm:"not null;default:false"`
+	JobID    *int      `json:"job_id"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (u *Upload) TableName() string {
+	return "uploads"
+}
@@ -19,6 +19,24 @@ type User struct {
 	Password string     `json:"password" gorm:"not null"`
 	Status   UserStatus `json:"status"`
 
+	// MaxBytes and MaxFiles override the default storage quota of the user, 0 is unlimited
+	MaxBytes  *int64 `json:"max_bytes"`
+	MaxFiles  *int64 `json:"max_files"`
+	UsedBytes int64  `json:"used_bytes" gorm:"not null;default:0"`
+	UsedFiles int64  `json:"used_files" gorm:"not null;default:0"`
+
+	// TOTPSecret is set when the user enrolls in two-factor authentication, which is only
+	// enforced once TOTPEnabled is set by confirming a code. TOTPLastStep is the time
+	// step of the last accepted code, codes of earlier steps are rejected.
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `json:"totp_enabled" gorm:"not null;default:false"`
+	TOTPLastStep int64  `json:"-" gorm:"not null;default:0"`
+	// MFAFailedAttempts counts the wrong codes of two-factor signins since the last right
+	// one, across challenges. The user can not sign in until MFALockedUntil once too many
+	// codes were wrong.
+	MFAFailedAttempts int        `json:"-" gorm:"not null;default:0"`
+	MFALockedUntil    *time.Time `json:"-"`
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
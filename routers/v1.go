@@ -30,8 +30,13 @@ func V1(router *gin.Engine, c *config.Config, db *gorm.DB, s *service.Services)
 	authEndpoint := "/auth"
 	auth := controllers.NewAuthController(c, db, s)
 	v1.POST(authEndpoint+"/signin", auth.Signin)
+	v1.POST(authEndpoint+"/signin/mfa", auth.SigninMFA)
 	v1.POST(authEndpoint+"/signup", auth.Signup)
-	//v1.POST(authEndpoint+"/verify", auth.Verify)
+	v1.POST(authEndpoint+"/refresh", auth.Refresh)
+	v1.POST(authEndpoint+"/verify", auth.Verify)
+	v1.POST(authEndpoint+"/verify/resend", auth.ResendVerification)
+	v1.POST(authEndpoint+"/password/forgot", auth.ForgotPassword)
+	v1.POST(authEndpoint+"/password/reset", auth.ResetPassword)
 
 	// User
 	usersEndpoint := "/users"
@@ -40,18 +45,78 @@ func V1(router *gin.Engine, c *config.Config, db *gorm.DB, s *service.Services)
 	// Filesystem
 	filesystemEndpoint := "/filesystem"
 	filesystem := controllers.NewFilesystemController(c, db, s)
-	v1.GET(filesystemEndpoint+"/download/:filename", filesystem.Download)
+
+	// Share
+	shareEndpoint := "/share"
+	v1.GET(shareEndpoint+"/:id", filesystem.DownloadShared)
+	v1.HEAD(shareEndpoint+"/:id", filesystem.DownloadShared)
+
+	// Uploads
+	uploadsEndpoint := filesystemEndpoint + "/uploads"
+	uploads := controllers.NewTusController(c, db, s)
+	v1.OPTIONS(uploadsEndpoint, uploads.Options)
+	v1.OPTIONS(uploadsEndpoint+"/:id", uploads.Options)
 
 	//////////////
 	// Authorized
 	tokenMaker, _ := utils.NewJWTMaker(c.TokenSymmetricKey)
-	authorizedV1 := router.Group("api/v1").Use(middlewares.AuthMiddleware(tokenMaker))
+	authorizedV1 := router.Group("api/v1").Use(middlewares.AuthMiddleware(tokenMaker, service.NewSessionStore(db)))
 
 	// User
 	authorizedV1.GET(usersEndpoint+"/me", users.Me)
+	authorizedV1.GET(usersEndpoint+"/me/storage", users.Storage)
+	authorizedV1.GET(usersEndpoint+"/me/sessions", users.Sessions)
+	authorizedV1.DELETE(usersEndpoint+"/me/sessions", users.RevokeSessions)
+	authorizedV1.DELETE(usersEndpoint+"/me/sessions/:id", users.RevokeSession)
+	authorizedV1.PUT(usersEndpoint+"/me/password", users.ChangePassword)
+	authorizedV1.POST(usersEndpoint+"/me/totp", users.EnrollTOTP)
+	authorizedV1.POST(usersEndpoint+"/me/totp/confirm", users.ConfirmTOTP)
+	authorizedV1.POST(usersEndpoint+"/me/totp/recovery-codes", users.RegenerateRecoveryCodes)
+	authorizedV1.POST(usersEndpoint+"/me/totp/disable", users.DisableTOTP)
+	authorizedV1.POST(authEndpoint+"/logout", auth.Logout)
 
 	// Filesystem
 	authorizedV1.POST(filesystemEndpoint+"/upload", filesystem.Upload)
+	authorizedV1.GET(filesystemEndpoint+"/jobs/:id", filesystem.Job)
+	authorizedV1.GET(filesystemEndpoint+"/download/:id", filesystem.Download)
+	authorizedV1.HEAD(filesystemEndpoint+"/download/:id", filesystem.Download)
+	authorizedV1.POST(filesystemEndpoint+"/download/bundle", filesystem.DownloadBundle)
 	authorizedV1.GET(filesystemEndpoint+"/my-files", users.MyFiles)
+	authorizedV1.GET(filesystemEndpoint+"/files/:id", filesystem.File)
+	authorizedV1.DELETE(filesystemEndpoint+"/files/:id", filesystem.DeleteFile)
+	authorizedV1.PATCH(filesystemEndpoint+"/files/:id/rename", filesystem.RenameFile)
+	authorizedV1.PATCH(filesystemEndpoint+"/files/:id/move", filesystem.MoveFile)
+	authorizedV1.POST(filesystemEndpoint+"/files/:id/copy", filesystem.CopyFile)
+	authorizedV1.PUT(filesystemEndpoint+"/files/:id/tags", filesystem.SetFileTags)
+	authorizedV1.GET(filesystemEndpoint+"/files/:id/versions", filesystem.FileVersions)
+	authorizedV1.DELETE(filesystemEndpoint+"/files/:id/versions", filesystem.PruneFileVersions)
+	authorizedV1.GET(filesystemEndpoint+"/files/:id/versions/:version/download", filesystem.DownloadFileVersion)
+	authorizedV1.POST(filesystemEndpoint+"/files/:id/versions/:version/restore", filesystem.RestoreFileVersion)
+	authorizedV1.GET(filesystemEndpoint+"/files/:id/entries", filesystem.ArchiveEntries)
+	authorizedV1.GET(filesystemEndpoint+"/files/:id/entries/content", filesystem.DownloadArchiveEntry)
+	authorizedV1.POST(filesystemEndpoint+"/files/:id/share", filesystem.CreateShareLink)
+	authorizedV1.GET(filesystemEndpoint+"/shares", filesystem.MyShareLinks)
+	authorizedV1.DELETE(filesystemEndpoint+"/shares/:id", filesystem.RevokeShareLink)
+
+	// Uploads
+	authorizedV1.POST(uploadsEndpoint, uploads.Create)
+	authorizedV1.HEAD(uploadsEndpoint+"/:id", uploads.Head)
+	authorizedV1.PATCH(uploadsEndpoint+"/:id", uploads.Patch)
+	authorizedV1.DELETE(uploadsEndpoint+"/:id", uploads.Terminate)
+
+	// Trash
+	trashEndpoint := filesystemEndpoint + "/trash"
+	authorizedV1.GET(trashEndpoint, filesystem.Trash)
+	authorizedV1.DELETE(trashEndpoint, filesystem.EmptyTrash)
+	authorizedV1.POST(trashEndpoint+"/:id/restore", filesystem.RestoreTrashedFile)
+
+	// Folders
+	foldersEndpoint := filesystemEndpoint + "/folders"
+	authorizedV1.POST(foldersEndpoint, filesystem.CreateFolder)
+	authorizedV1.GET(foldersEndpoint+"/:id/children", filesystem.FolderChildren)
+	authorizedV1.GET(foldersEndpoint+"/:id/path", filesystem.FolderPath)
+	authorizedV1.PATCH(foldersEndpoint+"/:id/rename", filesystem.RenameFolder)
+	authorizedV1.PATCH(foldersEndpoint+"/:id/move", filesystem.MoveFolder)
+	authorizedV1.DELETE(foldersEndpoint+"/:id", filesystem.DeleteFolder)
 	return router
 }
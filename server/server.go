@@ -25,8 +25,13 @@ func Init(c *config.Config, db *gorm.DB, s *service.Services) error {
 	// Setup Cors
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{"*", "http://localhost"}
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Role", "Authorization"}
+	corsConfig.AllowMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Content-Role", "Authorization",
+		"Range", "If-Range", "If-None-Match", "If-Modified-Since",
+		"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"}
+	corsConfig.ExposeHeaders = []string{"Content-Disposition", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified",
+		"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+		"Upload-Length", "Upload-Offset", "Upload-Metadata", "X-Extraction-Job-Id"}
 	server.Use(cors.New(corsConfig))
 
 	// Health Check
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidActionToken is returned when a token is unknown, expired, already used or issued for another purpose
+var ErrInvalidActionToken = errors.New("token is invalid or has expired")
+
+// hashActionToken returns the hash under which a token is stored
+func hashActionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueActionToken creates a single-use token for the user valid for duration, the
+// unused tokens previously issued for the same purpose stop working
+func IssueActionToken(tx *gorm.DB, userID int, purpose models.ActionTokenPurpose, duration time.Duration) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+
+	now := time.Now()
+	err := tx.Model(&models.ActionToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("expires_at", now).Error
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Create(&models.ActionToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashActionToken(token),
+		ExpiresAt: now.Add(duration),
+	}).Error
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumeActionToken checks a token issued for purpose and marks it as used
+func ConsumeActionToken(tx *gorm.DB, purpose models.ActionTokenPurpose, token string) (*models.ActionToken, error) {
+	actionToken, err := FindActionToken(tx, purpose, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := UseActionToken(tx, actionToken); err != nil {
+		return nil, err
+	}
+
+	return actionToken, nil
+}
+
+// FindActionToken checks a token issued for purpose without consuming it, its row is
+// locked until the end of the transaction
+func FindActionToken(tx *gorm.DB, purpose models.ActionTokenPurpose, token string) (*models.ActionToken, error) {
+	var tokens []models.ActionToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", hashActionToken(token), purpose).
+		Limit(1).Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrInvalidActionToken
+	}
+
+	actionToken := &tokens[0]
+	if actionToken.UsedAt != nil || !time.Now().Before(actionToken.ExpiresAt) {
+		return nil, ErrInvalidActionToken
+	}
+
+	return actionToken, nil
+}
+
+// UseActionToken marks a token returned by FindActionToken as used
+func UseActionToken(tx *gorm.DB, actionToken *models.ActionToken) error {
+	now := time.Now()
+	actionToken.UsedAt = &now
+	return tx.Model(actionToken).Update("used_at", now).Error
+}
+
+// FailActionToken records a failed confirmation of a token returned by FindActionToken,
+// the token is used up after maxAttempts failures
+func FailActionToken(tx *gorm.DB, actionToken *models.ActionToken, maxAttempts int) error {
+	actionToken.Attempts++
+	updates := map[string]any{"attempts": actionToken.Attempts}
+	if actionToken.Attempts >= maxAttempts {
+		now := time.Now()
+		actionToken.UsedAt = &now
+		updates["used_at"] = now
+	}
+	return tx.Model(actionToken).Updates(updates).Error
+}
+
+// LastActionTokenAt returns when the latest token of the user for purpose was issued,
+// the zero time when none was
+func LastActionTokenAt(db *gorm.DB, userID int, purpose models.ActionTokenPurpose) (time.Time, error) {
+	var tokens []models.ActionToken
+	err := db.Where("user_id = ? AND purpose = ?", userID, purpose).Order("created_at desc").Limit(1).Find(&tokens).Error
+	if err != nil || len(tokens) == 0 {
+		return time.Time{}, err
+	}
+	return tokens[0].CreatedAt, nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestIssueActionToken(t *testing.T) {
+	// Writes are wrapped in a transaction unless skipped, which would need a connection
+	db := dryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+	var token models.ActionToken
+	var raw string
+	err := db.Callback().Create().After("gorm:create").Register("test:token", func(tx *gorm.DB) {
+		token = *tx.Statement.Dest.(*models.ActionToken)
+	})
+	require.NoError(t, err)
+
+	raw, err = IssueActionToken(db, 1, models.ActionTokenVerifyEmail, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, raw, 43)
+
+	// Only the hash of the token is stored
+	require.Equal(t, hashActionToken(raw), token.TokenHash)
+	require.NotContains(t, token.TokenHash, raw)
+	require.WithinDuration(t, time.Now().Add(time.Hour), token.ExpiresAt, time.Minute)
+
+	other, err := IssueActionToken(db, 1, models.ActionTokenVerifyEmail, time.Hour)
+	require.NoError(t, err)
+	require.NotEqual(t, raw, other)
+}
+
+func TestConsumeActionTokenUnknown(t *testing.T) {
+	db := dryRunDB(t)
+	statements := recordQueries(t, db)
+
+	_, err := ConsumeActionToken(db, models.ActionTokenVerifyEmail, "token")
+	require.ErrorIs(t, err, ErrInvalidActionToken)
+	require.Len(t, *statements, 1)
+	require.Contains(t, (*statements)[0], "FOR UPDATE")
+}
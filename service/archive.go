@@ -0,0 +1,59 @@
+package service
+
+import (
+	"github.com/dbsSensei/filesystem-api/archive"
+	"github.com/dbsSensei/filesystem-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// indexBatchSize is the number of archive entries inserted per statement
+const indexBatchSize = 500
+
+// SaveArchiveIndex stores the entries of the archive with the given hash. Indexes
+// are shared by every file with the same content, so nothing is written when the
+// archive was already indexed.
+func SaveArchiveIndex(tx *gorm.DB, sha256 string, format archive.Format, entries []archive.Entry) error {
+	index := models.ArchiveIndex{Sha256: sha256, Format: string(format), Entries: len(entries)}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&index)
+	if result.Error != nil || result.RowsAffected == 0 || len(entries) == 0 {
+		return result.Error
+	}
+
+	rows := make([]models.ArchiveEntry, 0, len(entries))
+	for _, entry := range entries {
+		row := models.ArchiveEntry{
+			Sha256: sha256,
+			Path:   entry.Name,
+			Size:   entry.Size,
+			Mode:   entry.Mode,
+			IsDir:  entry.IsDir,
+			Offset: entry.Offset,
+		}
+		if !entry.ModTime.IsZero() {
+			modTime := entry.ModTime
+			row.ModTime = &modTime
+		}
+		rows = append(rows, row)
+	}
+
+	return tx.CreateInBatches(rows, indexBatchSize).Error
+}
+
+// FindArchiveIndex returns the index of the archive with the given hash, or nil
+// when the content was never indexed
+func FindArchiveIndex(tx *gorm.DB, sha256 string) (*models.ArchiveIndex, error) {
+	if sha256 == "" {
+		return nil, nil
+	}
+
+	var indexes []models.ArchiveIndex
+	if err := tx.Where("sha256 = ?", sha256).Limit(1).Find(&indexes).Error; err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+
+	return &indexes[0], nil
+}
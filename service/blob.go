@@ -0,0 +1,75 @@
+package service
+
+import (
+	"github.com/dbsSensei/filesystem-api/models"
+	"gorm.io/gorm"
+)
+
+// AcquireBlob adds a reference to the blob with the given hash, creating it from the
+// object stored under storageKey when the content is new. It returns the storage key
+// holding the content, when it differs from storageKey the object is a duplicate that
+// can be deleted once the transaction commits.
+func AcquireBlob(tx *gorm.DB, sha256 string, storageKey string, size int64) (string, error) {
+	var blob models.Blob
+	err := tx.Raw(`
+		INSERT INTO blobs (sha256, storage_key, size, ref_count, created_at, updated_at)
+		VALUES (?, ?, ?, 1, NOW(), NOW())
+		ON CONFLICT (sha256) DO UPDATE SET ref_count = blobs.ref_count + 1, updated_at = NOW()
+		RETURNING *`, sha256, storageKey, size).Scan(&blob).Error
+	if err != nil {
+		return "", err
+	}
+
+	return blob.StorageKey, nil
+}
+
+// LinkContent links a content stored before blobs existed, whose hash and size were just
+// computed, to the blob of its hash. The size that was not recorded yet is charged to the
+// user. When the blob already held the same content, the storage key the content used to
+// own is returned so the object can be deleted once the transaction commits.
+func LinkContent(tx *gorm.DB, userID int, content *models.FileContent, sha256 string, size int64) (string, error) {
+	blobKey, err := AcquireBlob(tx, sha256, content.StorageKey, size)
+	if err != nil {
+		return "", err
+	}
+
+	if err := AdjustUsage(tx, userID, size-content.Size, 0); err != nil {
+		return "", err
+	}
+
+	staleKey := ""
+	if blobKey != content.StorageKey {
+		staleKey = content.StorageKey
+	}
+
+	content.Sha256 = sha256
+	content.StorageKey = blobKey
+	content.Size = size
+	return staleKey, nil
+}
+
+// ReleaseContents drops the blob references of contents that are being deleted. Contents
+// stored before blobs existed own their object, their storage keys are returned so they
+// can be deleted once the transaction commits.
+func ReleaseContents(tx *gorm.DB, contents []models.FileContent) ([]string, error) {
+	var storageKeys []string
+	references := make(map[string]int)
+	for _, content := range contents {
+		if content.Sha256 == "" {
+			storageKeys = append(storageKeys, content.StorageKey)
+			continue
+		}
+		references[content.Sha256]++
+	}
+
+	for sha256, count := range references {
+		err := tx.Model(&models.Blob{}).
+			Where("sha256 = ?", sha256).
+			Updates(map[string]any{"ref_count": gorm.Expr("ref_count - ?", count)}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return storageKeys, nil
+}
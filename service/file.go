@@ -0,0 +1,195 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConflictPolicy decides what happens when a file is given the name of another file
+// of the same folder
+type ConflictPolicy string
+
+const (
+	// ConflictFail rejects the operation with ErrFileExists
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictOverwrite moves the other file to the trash
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictAutoSuffix picks the first free name among "name (1).ext", "name (2).ext"...
+	ConflictAutoSuffix ConflictPolicy = "auto_suffix"
+)
+
+// ErrFileExists is returned when a name is taken and the conflict policy is ConflictFail
+var ErrFileExists = errors.New("a file with the same name already exists")
+
+// FileNameError returns ErrFileExists for the violation of the unique name of the files
+// outside the trash, hit when a concurrent operation took the name after its conflict
+// was resolved, and err otherwise
+func FileNameError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrFileExists
+	}
+	return err
+}
+
+// maxSuffix bounds the names tried by ConflictAutoSuffix
+const maxSuffix = 1000
+
+// FindFileByPath returns the file named name in a folder of the user, locking it for
+// the rest of the transaction. It returns nil when there is no such file, names are
+// unique among the files outside the trash.
+func FindFileByPath(tx *gorm.DB, userID int, folderID *int, name string) (*models.Filesystem, error) {
+	var files []models.Filesystem
+	query := WhereParent(tx.Where("user_id = ? AND name = ?", userID, name), "folder_id", folderID)
+	if err := query.Clauses(clause.Locking{Strength: "UPDATE"}).Limit(1).Find(&files).Error; err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, nil
+	}
+	return &files[0], nil
+}
+
+// PushVersion keeps the current content of file as a version, so a new content can
+// replace it. The version number of file is increased.
+func PushVersion(tx *gorm.DB, file *models.Filesystem) error {
+	version := &models.FileVersion{
+		FilesystemID: file.ID,
+		Version:      file.Version,
+		FileContent:  file.FileContent,
+		CreatedAt:    file.UpdatedAt,
+	}
+	if err := tx.Create(version).Error; err != nil {
+		return err
+	}
+
+	file.Version++
+	return nil
+}
+
+// DeleteVersions deletes versions of files of the user and releases their contents and
+// usage. The storage keys to delete once the transaction commits are returned.
+func DeleteVersions(tx *gorm.DB, userID int, versions []models.FileVersion) ([]string, error) {
+	if len(versions) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int, 0, len(versions))
+	contents := make([]models.FileContent, 0, len(versions))
+	var bytes int64
+	for _, version := range versions {
+		ids = append(ids, version.ID)
+		contents = append(contents, version.FileContent)
+		bytes += version.Size
+	}
+
+	storageKeys, err := ReleaseContents(tx, contents)
+	if err != nil {
+		return nil, err
+	}
+	if err := AdjustUsage(tx, userID, -bytes, 0); err != nil {
+		return nil, err
+	}
+	if err := tx.Where("id IN ?", ids).Delete(&models.FileVersion{}).Error; err != nil {
+		return nil, err
+	}
+
+	return storageKeys, nil
+}
+
+// DeleteFiles permanently deletes files of the user with all their versions, trashed or
+// not, and releases their contents and usage. The storage keys to delete once the transaction commits are returned.
+func DeleteFiles(tx *gorm.DB, userID int, files []models.Filesystem) ([]string, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int, 0, len(files))
+	contents := make([]models.FileContent, 0, len(files))
+	var bytes int64
+	for _, file := range files {
+		ids = append(ids, file.ID)
+		contents = append(contents, file.FileContent)
+		bytes += file.Size
+	}
+
+	var versions []models.FileVersion
+	if err := tx.Where("filesystem_id IN ?", ids).Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	storageKeys, err := DeleteVersions(tx, userID, versions)
+	if err != nil {
+		return nil, err
+	}
+
+	fileKeys, err := ReleaseContents(tx, contents)
+	if err != nil {
+		return nil, err
+	}
+	if err := AdjustUsage(tx, userID, -bytes, -int64(len(files))); err != nil {
+		return nil, err
+	}
+	if err := tx.Where("filesystem_id IN ?", ids).Delete(&models.FileTag{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Filesystem{}).Error; err != nil {
+		return nil, err
+	}
+
+	return append(storageKeys, fileKeys...), nil
+}
+
+// ResolveNameConflict returns the name a file of the user should be given to be named
+// name in a folder, according to policy. exceptID is the file being renamed or moved,
+// which does not conflict with itself.
+func ResolveNameConflict(tx *gorm.DB, userID int, folderID *int, name string, policy ConflictPolicy, exceptID int) (string, error) {
+	existing, err := FindFileByPath(tx, userID, folderID, name)
+	if err != nil {
+		return "", err
+	}
+	if existing == nil || existing.ID == exceptID {
+		return name, nil
+	}
+
+	switch policy {
+	case ConflictOverwrite:
+		return name, tx.Delete(existing).Error
+	case ConflictAutoSuffix:
+		for n := 1; n <= maxSuffix; n++ {
+			candidate := SuffixedName(name, n)
+			existing, err := FindFileByPath(tx, userID, folderID, candidate)
+			if err != nil {
+				return "", err
+			}
+			if existing == nil {
+				return candidate, nil
+			}
+		}
+		return "", ErrFileExists
+	default:
+		return "", ErrFileExists
+	}
+}
+
+// SuffixedName inserts " (n)" before the extension of name, compressed tarballs keep
+// their whole ".tar.*" extension
+func SuffixedName(name string, n int) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if strings.HasSuffix(base, ".tar") {
+		ext = ".tar" + ext
+		base = strings.TrimSuffix(base, ".tar")
+	}
+	if base == "" {
+		// Dot files such as ".env" have no extension
+		base, ext = name, ""
+	}
+
+	return fmt.Sprintf("%s (%d)%s", base, n, ext)
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSuffixedName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		n        int
+		expected string
+	}{
+		{name: "report.pdf", n: 1, expected: "report (1).pdf"},
+		{name: "README", n: 2, expected: "README (2)"},
+		{name: "vendor.tar.gz", n: 1, expected: "vendor (1).tar.gz"},
+		{name: "backup.tar", n: 3, expected: "backup (3).tar"},
+		{name: ".env", n: 1, expected: ".env (1)"},
+		{name: "archive.v2.zip", n: 1, expected: "archive.v2 (1).zip"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, SuffixedName(tc.name, tc.n))
+		})
+	}
+}
+
+func TestFileNameError(t *testing.T) {
+	require.ErrorIs(t, FileNameError(fmt.Errorf("create file: %w", gorm.ErrDuplicatedKey)), ErrFileExists)
+	require.ErrorIs(t, FileNameError(gorm.ErrRecordNotFound), gorm.ErrRecordNotFound)
+	require.NoError(t, FileNameError(nil))
+}
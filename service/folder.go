@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WhereParent scopes the query to the entries of a folder, nil being the user root
+func WhereParent(query *gorm.DB, column string, folderID *int) *gorm.DB {
+	if folderID == nil {
+		return query.Where(column + " IS NULL")
+	}
+	return query.Where(column+" = ?", *folderID)
+}
+
+// findFolder returns the folder named name in the parent folder of the user
+func findFolder(tx *gorm.DB, userID int, parentID *int, name string) (*models.Folder, error) {
+	var folder models.Folder
+	query := tx.Where("user_id = ? AND name = ?", userID, name)
+	if err := WhereParent(query, "parent_id", parentID).First(&folder).Error; err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// EnsureFolderPath finds or creates every folder of a slash separated path below the
+// user root and returns the id of the last one, nil for the root itself
+func EnsureFolderPath(tx *gorm.DB, userID int, dirPath string, cache map[string]*int) (*int, error) {
+	if dirPath == "" || dirPath == "." {
+		return nil, nil
+	}
+	if folderID, ok := cache[dirPath]; ok {
+		return folderID, nil
+	}
+
+	var parentID *int
+	if index := strings.LastIndex(dirPath, "/"); index >= 0 {
+		var err error
+		parentID, err = EnsureFolderPath(tx, userID, dirPath[:index], cache)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name := dirPath[strings.LastIndex(dirPath, "/")+1:]
+
+	folder, err := findFolder(tx, userID, parentID, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// A concurrent job may create the same folder, the unique index keeps a single one
+		// and the conflicting insert selects it once the other job committed
+		folder = &models.Folder{
+			UserID:   userID,
+			ParentID: parentID,
+			Name:     name,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(folder)
+		err = result.Error
+		if err == nil && result.RowsAffected == 0 {
+			folder, err = findFolder(tx, userID, parentID, name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cache[dirPath] = &folder.ID
+	return &folder.ID, nil
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"gorm.io/gorm"
+)
+
+// FileSort is a column the files of a listing can be sorted on
+type FileSort string
+
+const (
+	FileSortName      FileSort = "name"
+	FileSortSize      FileSort = "size"
+	FileSortCreatedAt FileSort = "created_at"
+)
+
+// Ways a name filter matches the name of a file
+const (
+	NameMatchPrefix   = "prefix"
+	NameMatchContains = "contains"
+)
+
+// ErrInvalidCursor is returned when a listing cursor can not be decoded or was issued for another sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FileFilter selects the files of a user listed by MyFiles, zero fields do not filter
+type FileFilter struct {
+	UserID int
+
+	// Name matches the file names case-insensitively, as a prefix or a substring
+	Name      string
+	NameMatch string
+
+	// MimeType is matched exactly, or as a prefix when it ends with "/*"
+	MimeType string
+
+	MinSize       *int64
+	MaxSize       *int64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+
+	// FolderID restricts the listing to a folder, Root to the files outside any folder
+	FolderID *int
+	Root     bool
+
+	// Tags are the tags a file must all have
+	Tags []string
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// Apply adds the conditions of the filter to a query on the filesystem table.
+// Files in the trash are never listed.
+func (f FileFilter) Apply(db *gorm.DB) *gorm.DB {
+	query := db.Where("user_id = ? AND deleted_at IS NULL", f.UserID)
+
+	if f.Name != "" {
+		pattern := escapeLike(f.Name) + "%"
+		if f.NameMatch != NameMatchPrefix {
+			pattern = "%" + pattern
+		}
+		query = query.Where("name ILIKE ?", pattern)
+	}
+
+	if prefix, ok := strings.CutSuffix(f.MimeType, "/*"); ok {
+		query = query.Where("mime_type LIKE ?", escapeLike(prefix)+"/%")
+	} else if f.MimeType != "" {
+		query = query.Where("mime_type = ?", f.MimeType)
+	}
+
+	if f.MinSize != nil {
+		query = query.Where("size >= ?", *f.MinSize)
+	}
+	if f.MaxSize != nil {
+		query = query.Where("size <= ?", *f.MaxSize)
+	}
+	if f.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *f.CreatedBefore)
+	}
+
+	if f.Root {
+		query = query.Where("folder_id IS NULL")
+	} else if f.FolderID != nil {
+		query = query.Where("folder_id = ?", *f.FolderID)
+	}
+
+	if tags := uniqueTags(f.Tags); len(tags) > 0 {
+		query = query.Where(
+			"id IN (SELECT filesystem_id FROM file_tags WHERE name IN ? GROUP BY filesystem_id HAVING COUNT(*) = ?)",
+			tags, len(tags),
+		)
+	}
+
+	return query
+}
+
+// FileCursor is the position of the last file of a page in a cursor paginated listing
+type FileCursor struct {
+	Sort  FileSort `json:"s"`
+	Desc  bool     `json:"d"`
+	Value string   `json:"v"`
+	ID    int      `json:"i"`
+}
+
+// NewFileCursor returns the cursor positioned after file
+func NewFileCursor(sort FileSort, desc bool, file *models.Filesystem) FileCursor {
+	cursor := FileCursor{Sort: sort, Desc: desc, ID: file.ID}
+	switch sort {
+	case FileSortName:
+		cursor.Value = file.Name
+	case FileSortSize:
+		cursor.Value = strconv.FormatInt(file.Size, 10)
+	default:
+		cursor.Value = file.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return cursor
+}
+
+// Encode returns the opaque representation of the cursor handed to clients
+func (c FileCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeFileCursor parses a cursor returned by Encode, it must have been issued for the same sort
+func DecodeFileCursor(encoded string, sort FileSort, desc bool) (*FileCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor FileCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sort || cursor.Desc != desc || cursor.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	if _, err := cursor.value(); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// value returns the sort value of the cursor with the type of its column
+func (c FileCursor) value() (any, error) {
+	switch c.Sort {
+	case FileSortName:
+		return c.Value, nil
+	case FileSortSize:
+		return strconv.ParseInt(c.Value, 10, 64)
+	default:
+		return time.Parse(time.RFC3339Nano, c.Value)
+	}
+}
+
+// OrderFiles sorts a listing on the given column, ties are broken by id so the
+// order is total. With a cursor, only the files after it are selected, which keeps
+// pages stable when files are added concurrently.
+func OrderFiles(db *gorm.DB, sort FileSort, desc bool, cursor *FileCursor) *gorm.DB {
+	column := string(FileSortCreatedAt)
+	switch sort {
+	case FileSortName, FileSortSize:
+		column = string(sort)
+	}
+
+	direction, comparison := "asc", ">"
+	if desc {
+		direction, comparison = "desc", "<"
+	}
+
+	query := db
+	if cursor != nil {
+		value, _ := cursor.value()
+		query = query.Where("("+column+", id) "+comparison+" (?, ?)", value, cursor.ID)
+	}
+
+	return query.Order(column + " " + direction).Order("id " + direction)
+}
+
+// uniqueTags trims the tags and drops the empty and repeated ones, keeping their order
+func uniqueTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	unique := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		unique = append(unique, tag)
+	}
+	return unique
+}
+
+// SetFileTags replaces the tags of a file and returns them
+func SetFileTags(tx *gorm.DB, fileID int, tags []string) ([]string, error) {
+	tags = uniqueTags(tags)
+
+	if err := tx.Where("filesystem_id = ?", fileID).Delete(&models.FileTag{}).Error; err != nil {
+		return nil, err
+	}
+
+	if len(tags) > 0 {
+		rows := make([]models.FileTag, 0, len(tags))
+		for _, tag := range tags {
+			rows = append(rows, models.FileTag{FilesystemID: fileID, Name: tag})
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// FileTags returns the tags of each of the files, sorted by name
+func FileTags(db *gorm.DB, fileIDs []int) (map[int][]string, error) {
+	tags := make(map[int][]string, len(fileIDs))
+	if len(fileIDs) == 0 {
+		return tags, nil
+	}
+
+	var rows []models.FileTag
+	if err := db.Where("filesystem_id IN ?", fileIDs).Order("name").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		tags[row.FilesystemID] = append(tags[row.FilesystemID], row.Name)
+	}
+
+	return tags, nil
+}
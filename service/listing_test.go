@@ -0,0 +1,90 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds statements without connecting to a database
+func dryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	require.NoError(t, err)
+	return db
+}
+
+func TestFileFilterApply(t *testing.T) {
+	db := dryRunDB(t)
+	minSize := int64(10)
+	folderID := 3
+
+	filter := FileFilter{
+		UserID:    1,
+		Name:      "50%_off",
+		NameMatch: NameMatchPrefix,
+		MimeType:  "image/*",
+		MinSize:   &minSize,
+		FolderID:  &folderID,
+		Tags:      []string{"work", " work ", ""},
+	}
+
+	var files []models.Filesystem
+	statement := filter.Apply(db.Model(&models.Filesystem{})).Find(&files).Statement
+	sql := statement.SQL.String()
+
+	require.Contains(t, sql, "name ILIKE $2")
+	require.Contains(t, sql, "mime_type LIKE $3")
+	require.Contains(t, sql, "size >= $4")
+	require.Contains(t, sql, "folder_id = $5")
+	require.Contains(t, sql, "HAVING COUNT(*) = $7")
+	require.NotContains(t, sql, "created_at")
+	require.Equal(t, []any{1, `50\%\_off%`, "image/%", int64(10), 3, "work", 1}, statement.Vars)
+}
+
+func TestOrderFiles(t *testing.T) {
+	db := dryRunDB(t)
+
+	var files []models.Filesystem
+	statement := OrderFiles(db.Model(&models.Filesystem{}), FileSortSize, true, nil).Find(&files).Statement
+	require.Contains(t, statement.SQL.String(), "ORDER BY size desc,id desc")
+
+	cursor := &FileCursor{Sort: FileSortName, Value: "b.txt", ID: 7}
+	statement = OrderFiles(db.Model(&models.Filesystem{}), FileSortName, false, cursor).Find(&files).Statement
+	require.Contains(t, statement.SQL.String(), "(name, id) > ($1, $2)")
+	require.Contains(t, statement.SQL.String(), "ORDER BY name asc,id asc")
+	require.Equal(t, []any{"b.txt", 7}, statement.Vars)
+}
+
+func TestFileCursor(t *testing.T) {
+	createdAt := time.Date(2023, 7, 1, 12, 0, 0, 123, time.FixedZone("", 3600))
+	file := &models.Filesystem{ID: 42, Name: "a.txt", FileContent: models.FileContent{Size: 5}, CreatedAt: createdAt}
+
+	encoded := NewFileCursor(FileSortCreatedAt, true, file).Encode()
+	cursor, err := DecodeFileCursor(encoded, FileSortCreatedAt, true)
+	require.NoError(t, err)
+	require.Equal(t, 42, cursor.ID)
+
+	value, err := cursor.value()
+	require.NoError(t, err)
+	require.True(t, createdAt.Equal(value.(time.Time)))
+
+	// Cursors are only valid for the sort they were issued for
+	_, err = DecodeFileCursor(encoded, FileSortCreatedAt, false)
+	require.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = DecodeFileCursor(encoded, FileSortName, true)
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = DecodeFileCursor("not a cursor", FileSortCreatedAt, true)
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	forged := FileCursor{Sort: FileSortSize, Value: "large", ID: 1}.Encode()
+	_, err = DecodeFileCursor(forged, FileSortSize, false)
+	require.ErrorIs(t, err, ErrInvalidCursor)
+}
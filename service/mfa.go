@@ -0,0 +1,254 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// RecoveryCodeCount is the number of recovery codes generated at once
+	RecoveryCodeCount = 10
+	// MaxMFAAttempts is the number of wrong codes after which a signin challenge is used
+	// up, and the user is locked out of two-factor signins
+	MaxMFAAttempts = 5
+	// MFALockoutDuration is how long the first lockout lasts, each following lockout
+	// without a right code in between lasts twice as long up to MaxMFALockoutDuration
+	MFALockoutDuration    = 15 * time.Minute
+	MaxMFALockoutDuration = 24 * time.Hour
+)
+
+var (
+	// ErrInvalidMFACode is returned when a TOTP or recovery code is wrong, expired or was already used
+	ErrInvalidMFACode = errors.New("invalid authentication code")
+	// ErrMFALockedOut is returned while a user is locked out after too many wrong codes
+	ErrMFALockedOut = errors.New("too many invalid authentication codes, try again later")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// normalizeRecoveryCode drops the separators and the case of a recovery code as typed by a user
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// hashRecoveryCode returns the hash under which a recovery code is stored
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// isTOTPCode tells whether a code has the shape of a TOTP code rather than a recovery code
+func isTOTPCode(code string) bool {
+	if len(code) != utils.TOTPDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// StartTOTPEnrollment stores a new TOTP secret for the user and returns it, two-factor
+// authentication is enforced once EnableTOTP confirms a code of the secret
+func StartTOTPEnrollment(tx *gorm.DB, userID int) (string, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]any{"totp_secret": secret, "totp_last_step": 0}).Error
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// checkTOTPCode validates a TOTP code of the user, the time step it matched is recorded
+// atomically so that each code is only accepted once
+func checkTOTPCode(tx *gorm.DB, user *models.User, code string) error {
+	if user.TOTPSecret == "" {
+		return ErrInvalidMFACode
+	}
+
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return ErrInvalidMFACode
+	}
+
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+
+	user.TOTPLastStep = step
+	return nil
+}
+
+// EnableTOTP turns on two-factor authentication once the user proved their device
+// generates the codes of the enrolled secret, and returns their recovery codes
+func EnableTOTP(tx *gorm.DB, user *models.User, code string) ([]string, error) {
+	if err := checkTOTPCode(tx, user, strings.TrimSpace(code)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("totp_enabled", true).Error; err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+
+	return GenerateRecoveryCodes(tx, user.ID)
+}
+
+// DisableTOTP turns off two-factor authentication and forgets the secret and recovery codes
+func DisableTOTP(tx *gorm.DB, userID int) error {
+	err := tx.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]any{"totp_secret": "", "totp_enabled": false, "totp_last_step": 0}).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+// GenerateRecoveryCodes replaces the recovery codes of the user and returns them, they
+// can not be retrieved afterwards
+func GenerateRecoveryCodes(tx *gorm.DB, userID int) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, RecoveryCodeCount)
+	random := make([]byte, 10)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+
+		encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(random))
+		code := encoded[0:4] + "-" + encoded[4:8] + "-" + encoded[8:12] + "-" + encoded[12:16]
+		codes = append(codes, code)
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)})
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// useRecoveryCode consumes an unused recovery code of the user
+func useRecoveryCode(tx *gorm.DB, userID int, code string) error {
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// VerifySecondFactor checks the code a user with two-factor authentication enabled
+// signs in with, either a TOTP code or one of their recovery codes
+func VerifySecondFactor(tx *gorm.DB, user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrInvalidMFACode
+	}
+
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		return checkTOTPCode(tx, user, code)
+	}
+	return useRecoveryCode(tx, user.ID, code)
+}
+
+// LockUser loads a user and locks it until the end of the transaction
+func LockUser(tx *gorm.DB, userID int) (*models.User, error) {
+	var user models.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// MFALockedOut reports whether the user is locked out of two-factor signins at now
+func MFALockedOut(user *models.User, now time.Time) bool {
+	return user.MFALockedUntil != nil && now.Before(*user.MFALockedUntil)
+}
+
+// mfaLockout returns how long a user is locked out after failures wrong codes in a row,
+// zero when the last one does not lock them out
+func mfaLockout(failures int) time.Duration {
+	if failures == 0 || failures%MaxMFAAttempts != 0 {
+		return 0
+	}
+
+	lockout := MFALockoutDuration
+	for i := MaxMFAAttempts; i < failures && lockout < MaxMFALockoutDuration; i += MaxMFAAttempts {
+		lockout *= 2
+	}
+	if lockout > MaxMFALockoutDuration {
+		lockout = MaxMFALockoutDuration
+	}
+	return lockout
+}
+
+// VerifySigninSecondFactor checks the code of a two-factor signin. Wrong codes are counted
+// for the user whatever the challenge, so signing in again does not allow more guesses:
+// every MaxMFAAttempts wrong codes in a row lock the user out, a right code resets the
+// count. The user must be locked by the transaction, which is committed on failures.
+func VerifySigninSecondFactor(tx *gorm.DB, user *models.User, code string, now time.Time) error {
+	if MFALockedOut(user, now) {
+		return ErrMFALockedOut
+	}
+
+	err := VerifySecondFactor(tx, user, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		user.MFAFailedAttempts++
+		updates := map[string]any{"mfa_failed_attempts": user.MFAFailedAttempts}
+		if lockout := mfaLockout(user.MFAFailedAttempts); lockout > 0 {
+			lockedUntil := now.Add(lockout)
+			user.MFALockedUntil = &lockedUntil
+			updates["mfa_locked_until"] = lockedUntil
+		}
+
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return ErrInvalidMFACode
+	}
+	if err != nil {
+		return err
+	}
+
+	if user.MFAFailedAttempts == 0 && user.MFALockedUntil == nil {
+		return nil
+	}
+	user.MFAFailedAttempts, user.MFALockedUntil = 0, nil
+	return tx.Model(&models.User{}).Where("id = ?", user.ID).
+		Updates(map[string]any{"mfa_failed_attempts": 0, "mfa_locked_until": nil}).Error
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	db := dryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+	var rows []models.RecoveryCode
+	err := db.Callback().Create().After("gorm:create").Register("test:codes", func(tx *gorm.DB) {
+		rows = *tx.Statement.Dest.(*[]models.RecoveryCode)
+	})
+	require.NoError(t, err)
+
+	codes, err := GenerateRecoveryCodes(db, 1)
+	require.NoError(t, err)
+	require.Len(t, codes, RecoveryCodeCount)
+	require.Len(t, rows, RecoveryCodeCount)
+
+	for i, code := range codes {
+		require.Regexp(t, regexp.MustCompile(`^[a-z2-7]{4}(-[a-z2-7]{4}){3}$`), code)
+		require.Equal(t, hashRecoveryCode(code), rows[i].CodeHash)
+		require.Equal(t, 1, rows[i].UserID)
+	}
+
+	// Codes are matched whatever their case and separators
+	require.Equal(t, hashRecoveryCode(codes[0]), hashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))))
+}
+
+func TestIsTOTPCode(t *testing.T) {
+	require.True(t, isTOTPCode("012345"))
+	require.False(t, isTOTPCode("12345"))
+	require.False(t, isTOTPCode("12345a"))
+	require.False(t, isTOTPCode("abcd-efgh-ijkl-mnop"))
+}
+
+func TestCheckTOTPCodeReplay(t *testing.T) {
+	db := dryRunDB(t)
+	statements := recordQueries(t, db)
+
+	secret, err := utils.GenerateTOTPSecret()
+	require.NoError(t, err)
+	step := utils.TOTPStep(time.Now())
+	code, err := utils.TOTPCode(secret, step)
+	require.NoError(t, err)
+
+	// A code of a step that was already used is rejected without a query
+	user := &models.User{ID: 1, TOTPSecret: secret, TOTPEnabled: true, TOTPLastStep: step}
+	require.ErrorIs(t, VerifySecondFactor(db, user, code), ErrInvalidMFACode)
+	require.Empty(t, *statements)
+
+	user.TOTPEnabled = false
+	user.TOTPLastStep = 0
+	require.ErrorIs(t, VerifySecondFactor(db, user, code), ErrInvalidMFACode)
+}
+
+func TestFailActionToken(t *testing.T) {
+	db := dryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+
+	token := &models.ActionToken{ID: 1, Attempts: MaxMFAAttempts - 2}
+	require.NoError(t, FailActionToken(db, token, MaxMFAAttempts))
+	require.Nil(t, token.UsedAt)
+
+	// The token is used up by the last allowed failure
+	require.NoError(t, FailActionToken(db, token, MaxMFAAttempts))
+	require.Equal(t, MaxMFAAttempts, token.Attempts)
+	require.NotNil(t, token.UsedAt)
+}
+
+func TestMFALockout(t *testing.T) {
+	require.Zero(t, mfaLockout(0))
+	require.Zero(t, mfaLockout(MaxMFAAttempts-1))
+	require.Equal(t, MFALockoutDuration, mfaLockout(MaxMFAAttempts))
+	require.Zero(t, mfaLockout(MaxMFAAttempts+1))
+	require.Equal(t, 2*MFALockoutDuration, mfaLockout(2*MaxMFAAttempts))
+	require.Equal(t, MaxMFALockoutDuration, mfaLockout(100*MaxMFAAttempts))
+}
+
+func TestVerifySigninSecondFactor(t *testing.T) {
+	db := dryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+	var statements []string
+	err := db.Callback().Update().After("gorm:update").Register("test:record", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+	})
+	require.NoError(t, err)
+
+	secret, err := utils.GenerateTOTPSecret()
+	require.NoError(t, err)
+	now := time.Now()
+
+	// A locked out user is rejected before the code is checked
+	lockedUntil := now.Add(time.Minute)
+	user := &models.User{ID: 1, TOTPSecret: secret, TOTPEnabled: true, MFALockedUntil: &lockedUntil}
+	require.ErrorIs(t, VerifySigninSecondFactor(db, user, "000000", now), ErrMFALockedOut)
+	require.Empty(t, statements)
+
+	// Wrong codes are counted for the user, the last allowed one locks them out
+	user = &models.User{ID: 1, TOTPSecret: secret, TOTPEnabled: true, MFAFailedAttempts: MaxMFAAttempts - 1}
+	require.ErrorIs(t, VerifySigninSecondFactor(db, user, "abcd-efgh-ijkl-mnop", now), ErrInvalidMFACode)
+	require.Equal(t, MaxMFAAttempts, user.MFAFailedAttempts)
+	require.NotNil(t, user.MFALockedUntil)
+	require.Equal(t, now.Add(MFALockoutDuration), *user.MFALockedUntil)
+	require.Len(t, statements, 2)
+	require.Contains(t, statements[1], "mfa_locked_until")
+	require.True(t, MFALockedOut(user, now))
+	require.False(t, MFALockedOut(user, now.Add(MFALockoutDuration)))
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"gorm.io/gorm"
+)
+
+// SetPassword replaces the password of the user and signs them out everywhere: every
+// session is revoked and the reset tokens that were not used stop working.
+func SetPassword(tx *gorm.DB, userID int, password string) error {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&models.User{}).Where("id = ?", userID).Update("password", hashedPassword).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&models.ActionToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, models.ActionTokenResetPassword).
+		Update("expires_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+
+	_, err = RevokeUserSessions(tx, userID)
+	return err
+}
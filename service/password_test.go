@@ -0,0 +1,31 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSetPassword(t *testing.T) {
+	db := dryRunDB(t).Session(&gorm.Session{SkipDefaultTransaction: true})
+	var statements []string
+	var hashedPassword string
+	err := db.Callback().Update().After("gorm:update").Register("test:record", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+		if len(statements) == 1 {
+			hashedPassword = tx.Statement.Vars[0].(string)
+		}
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, SetPassword(db, 1, "new password"))
+	require.Len(t, statements, 3)
+
+	// The password is stored hashed
+	require.Contains(t, statements[0], `UPDATE "users" SET "password"`)
+	require.NoError(t, utils.CheckPassword("new password", hashedPassword))
+	require.Contains(t, statements[1], `UPDATE "action_tokens" SET "expires_at"`)
+	require.Contains(t, statements[2], `UPDATE "tokens" SET "is_blocked"`)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dbsSensei/filesystem-api/config"
+	"github.com/dbsSensei/filesystem-api/models"
+	"gorm.io/gorm"
+)
+
+// ErrQuotaExceeded is matched by every QuotaError
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// Limits of a storage quota
+const (
+	QuotaLimitBytes = "max_bytes"
+	QuotaLimitFiles = "max_files"
+)
+
+// QuotaError is returned when storing files would take a user over one of its limits
+type QuotaError struct {
+	Limit string
+	Max   int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%v: %v of %v", ErrQuotaExceeded, e.Limit, e.Max)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// Quota holds the storage limits of a user, a zero limit is unlimited
+type Quota struct {
+	MaxBytes int64
+	MaxFiles int64
+}
+
+// UserQuota returns the quota of user, falling back to the configured defaults
+func UserQuota(c *config.Config, user *models.User) Quota {
+	quota := Quota{
+		MaxBytes: c.QuotaDefaultMaxBytes,
+		MaxFiles: c.QuotaDefaultMaxFiles,
+	}
+	if user.MaxBytes != nil {
+		quota.MaxBytes = *user.MaxBytes
+	}
+	if user.MaxFiles != nil {
+		quota.MaxFiles = *user.MaxFiles
+	}
+	return quota
+}
+
+// Check returns a QuotaError when adding bytes and files to the usage of user exceeds the quota
+func (q Quota) Check(user *models.User, bytes int64, files int64) error {
+	if q.MaxBytes > 0 && user.UsedBytes+bytes > q.MaxBytes {
+		return &QuotaError{Limit: QuotaLimitBytes, Max: q.MaxBytes}
+	}
+	if q.MaxFiles > 0 && user.UsedFiles+files > q.MaxFiles {
+		return &QuotaError{Limit: QuotaLimitFiles, Max: q.MaxFiles}
+	}
+	return nil
+}
+
+// ChargeUsage adds bytes and files to the usage of a user, failing with a QuotaError
+// instead when the quota does not allow it. The check and the update are a single
+// statement, so concurrent uploads can not exceed the quota together.
+func ChargeUsage(tx *gorm.DB, userID int, quota Quota, bytes int64, files int64) error {
+	result := tx.Model(&models.User{}).
+		Where("id = ?", userID).
+		Where("(? = 0 OR used_bytes + ? <= ?)", quota.MaxBytes, bytes, quota.MaxBytes).
+		Where("(? = 0 OR used_files + ? <= ?)", quota.MaxFiles, files, quota.MaxFiles).
+		UpdateColumns(map[string]any{
+			"used_bytes": gorm.Expr("used_bytes + ?", bytes),
+			"used_files": gorm.Expr("used_files + ?", files),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	// Nothing was updated, find out which limit was hit
+	var user models.User
+	if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	if err := quota.Check(&user, bytes, files); err != nil {
+		return err
+	}
+	return &QuotaError{Limit: QuotaLimitBytes, Max: quota.MaxBytes}
+}
+
+// AdjustUsage adds bytes and files to the usage of a user without checking its quota,
+// negative values release the usage of deleted files
+func AdjustUsage(tx *gorm.DB, userID int, bytes int64, files int64) error {
+	return tx.Model(&models.User{}).
+		Where("id = ?", userID).
+		UpdateColumns(map[string]any{
+			"used_bytes": gorm.Expr("used_bytes + ?", bytes),
+			"used_files": gorm.Expr("used_files + ?", files),
+		}).Error
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dbsSensei/filesystem-api/config"
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserQuota(t *testing.T) {
+	c := &config.Config{QuotaDefaultMaxBytes: 100, QuotaDefaultMaxFiles: 10}
+
+	quota := UserQuota(c, &models.User{})
+	require.Equal(t, Quota{MaxBytes: 100, MaxFiles: 10}, quota)
+
+	unlimited := int64(0)
+	quota = UserQuota(c, &models.User{MaxBytes: &unlimited})
+	require.Equal(t, Quota{MaxBytes: 0, MaxFiles: 10}, quota)
+}
+
+func TestQuotaCheck(t *testing.T) {
+	quota := Quota{MaxBytes: 100, MaxFiles: 2}
+	user := &models.User{UsedBytes: 60, UsedFiles: 1}
+
+	require.NoError(t, quota.Check(user, 40, 1))
+
+	err := quota.Check(user, 41, 0)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	require.Equal(t, &QuotaError{Limit: QuotaLimitBytes, Max: 100}, err)
+
+	err = quota.Check(user, 0, 2)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	require.Equal(t, &QuotaError{Limit: QuotaLimitFiles, Max: 2}, err)
+
+	require.NoError(t, Quota{}.Check(user, 1<<40, 1<<20))
+}
@@ -2,45 +2,71 @@ package service
 
 import (
 	"fmt"
+
+	"github.com/dbsSensei/filesystem-api/utils"
 	"gorm.io/gorm"
 )
 
+// MaxPageSize is the largest page FindPage returns
+const MaxPageSize = 100
+
+// ErrInvalidPage is returned by FindPage when the page or its size is out of bounds
+var ErrInvalidPage = fmt.Errorf("page must be at least 1 and limit between 1 and %d", MaxPageSize)
+
 type Entity interface {
 	TableName() string
 }
 
-type Repository struct {
-	entity Entity
-	db     *gorm.DB
+// entityPointer is a pointer to a model, whose TableName is declared on the pointer receiver
+type entityPointer[T any] interface {
+	*T
+	Entity
 }
 
-type IRepository interface {
-	FindOne(id int, dbTransaction *gorm.DB) (any, error)
-	FindAll(applyFilterAndSort func(db *gorm.DB) *gorm.DB, dbTransaction *gorm.DB) ([]map[string]any, error)
-	Create(form any, dbTransaction *gorm.DB) (any, error)
-	Update(id int, form any, dbTransaction *gorm.DB) (any, error)
+// QueryFunc adds conditions or an order to a query
+type QueryFunc func(db *gorm.DB) *gorm.DB
+
+type Repository[T any, PT entityPointer[T]] struct {
+	db *gorm.DB
+}
+
+type IRepository[T any] interface {
+	FindOne(id int, dbTransaction *gorm.DB) (*T, error)
+	// FindAll returns every record matching filter, in the order it sets
+	FindAll(filter QueryFunc, dbTransaction *gorm.DB) ([]T, error)
+	// FindPage returns a page of the records matching filter sorted by sort, along with
+	// the pagination computed from the number of matching records
+	FindPage(pageNum int, pageSize int, filter QueryFunc, sort QueryFunc, dbTransaction *gorm.DB) ([]T, utils.Pagination, error)
+	Create(form *T, dbTransaction *gorm.DB) (*T, error)
+	Update(id int, form *T, dbTransaction *gorm.DB) (*T, error)
 	Delete(id int, dbTransaction *gorm.DB) error
 }
 
-func NewRepository(entity Entity, db *gorm.DB) IRepository {
-	return &Repository{
-		entity: entity,
-		db:     db,
+func NewRepository[T any, PT entityPointer[T]](db *gorm.DB) IRepository[T] {
+	return &Repository[T, PT]{
+		db: db,
 	}
 }
 
-func (r *Repository) getDB(dbTransaction *gorm.DB) *gorm.DB {
+func (r *Repository[T, PT]) getDB(dbTransaction *gorm.DB) *gorm.DB {
 	if dbTransaction != nil {
 		return dbTransaction
 	}
 	return r.db
 }
 
-func (r *Repository) FindOne(id int, dbTransaction *gorm.DB) (any, error) {
-	db := r.getDB(dbTransaction)
+// query starts a statement on the table of the model
+func (r *Repository[T, PT]) query(dbTransaction *gorm.DB, filter QueryFunc) *gorm.DB {
+	query := r.getDB(dbTransaction).Model(PT(new(T)))
+	if filter != nil {
+		query = filter(query)
+	}
+	return query
+}
 
-	entity := r.entity
-	err := db.Model(entity).Where("id = ?", id).First(entity).Error
+func (r *Repository[T, PT]) FindOne(id int, dbTransaction *gorm.DB) (*T, error) {
+	entity := new(T)
+	err := r.query(dbTransaction, nil).Where("id = ?", id).First(entity).Error
 	if err != nil {
 		return nil, err
 	}
@@ -48,31 +74,43 @@ func (r *Repository) FindOne(id int, dbTransaction *gorm.DB) (any, error) {
 	return entity, nil
 }
 
-func (r *Repository) FindAll(applyFilterAndSort func(db *gorm.DB) *gorm.DB, dbTransaction *gorm.DB) ([]map[string]any, error) {
-	db := r.getDB(dbTransaction)
+func (r *Repository[T, PT]) FindAll(filter QueryFunc, dbTransaction *gorm.DB) ([]T, error) {
+	entities := []T{}
+	if err := r.query(dbTransaction, filter).Find(&entities).Error; err != nil {
+		return nil, err
+	}
+
+	return entities, nil
+}
+
+func (r *Repository[T, PT]) FindPage(pageNum int, pageSize int, filter QueryFunc, sort QueryFunc, dbTransaction *gorm.DB) ([]T, utils.Pagination, error) {
+	if pageNum < 1 || pageSize < 1 || pageSize > MaxPageSize {
+		return nil, utils.Pagination{}, ErrInvalidPage
+	}
 
+	// Count the matching records only, the order does not change it
 	var count int64
-	err := db.Model(r.entity).Count(&count).Error
-	if err != nil {
-		return nil, err
+	if err := r.query(dbTransaction, filter).Count(&count).Error; err != nil {
+		return nil, utils.Pagination{}, err
 	}
 
-	var entities []map[string]any
-	query := db.Table(r.entity.TableName())
-	query = applyFilterAndSort(query)
-	res := query.Find(&entities)
-	if res.Error != nil {
-		fmt.Printf("error, %+v\n", res.Error)
-		return nil, err
+	entities := []T{}
+	query := r.query(dbTransaction, filter)
+	if sort != nil {
+		query = sort(query)
+	}
+	err := query.Offset((pageNum - 1) * pageSize).Limit(pageSize).Find(&entities).Error
+	if err != nil {
+		return nil, utils.Pagination{}, err
 	}
 
-	return entities, nil
+	return entities, utils.Paginate(count, pageNum, pageSize), nil
 }
 
-func (r *Repository) Create(form any, dbTransaction *gorm.DB) (any, error) {
+func (r *Repository[T, PT]) Create(form *T, dbTransaction *gorm.DB) (*T, error) {
 	db := r.getDB(dbTransaction)
 
-	result := db.Table(r.entity.TableName()).Select("*").Create(form)
+	result := db.Table(PT(form).TableName()).Select("*").Create(form)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -80,12 +118,10 @@ func (r *Repository) Create(form any, dbTransaction *gorm.DB) (any, error) {
 	return form, nil
 }
 
-func (r *Repository) Update(id int, form any, dbTransaction *gorm.DB) (any, error) {
+func (r *Repository[T, PT]) Update(id int, form *T, dbTransaction *gorm.DB) (*T, error) {
 	db := r.getDB(dbTransaction)
 
-	entity := r.entity
-	err := db.Model(entity).Where("id = ?", id).First(entity).Error
-	if err != nil {
+	if _, err := r.FindOne(id, db); err != nil {
 		return nil, err
 	}
 
@@ -94,19 +130,18 @@ func (r *Repository) Update(id int, form any, dbTransaction *gorm.DB) (any, erro
 		return nil, result.Error
 	}
 
-	return entity, nil
+	return form, nil
 }
 
-func (r *Repository) Delete(id int, dbTransaction *gorm.DB) error {
+func (r *Repository[T, PT]) Delete(id int, dbTransaction *gorm.DB) error {
 	db := r.getDB(dbTransaction)
 
-	entity := r.entity
-	err := db.Model(entity).Where("id = ?", id).First(entity).Error
+	entity, err := r.FindOne(id, db)
 	if err != nil {
 		return err
 	}
 
-	result := db.Delete(entity)
+	result := db.Delete(PT(entity))
 	if result.Error != nil {
 		return result.Error
 	}
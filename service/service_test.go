@@ -0,0 +1,86 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// recordQueries returns the statements of the queries run on db
+func recordQueries(t *testing.T, db *gorm.DB) *[]string {
+	var statements []string
+	err := db.Callback().Query().After("gorm:query").Register("test:record", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+	})
+	require.NoError(t, err)
+	return &statements
+}
+
+func TestRepositoryFindPage(t *testing.T) {
+	db := dryRunDB(t)
+	statements := recordQueries(t, db)
+	repository := NewRepository[models.Folder](db)
+
+	filter := func(query *gorm.DB) *gorm.DB {
+		return query.Where("user_id = ?", 1)
+	}
+	sort := func(query *gorm.DB) *gorm.DB {
+		return query.Order("name")
+	}
+
+	folders, pagination, err := repository.FindPage(2, 10, filter, sort, nil)
+	require.NoError(t, err)
+	require.Empty(t, folders)
+	require.Equal(t, utils.Paginate(0, 2, 10), pagination)
+
+	// The count only applies the filter, the page applies the order and bounds
+	require.Len(t, *statements, 2)
+	require.Contains(t, (*statements)[0], "count(*)")
+	require.Contains(t, (*statements)[0], "user_id = $1")
+	require.NotContains(t, (*statements)[0], "ORDER BY")
+	require.NotContains(t, (*statements)[0], "LIMIT")
+	require.Contains(t, (*statements)[1], "user_id = $1")
+	require.Contains(t, (*statements)[1], "ORDER BY name LIMIT 10 OFFSET 10")
+}
+
+func TestRepositoryFindPageBounds(t *testing.T) {
+	repository := NewRepository[models.Folder](dryRunDB(t))
+
+	testCases := []struct {
+		name     string
+		pageNum  int
+		pageSize int
+	}{
+		{name: "ZeroPage", pageNum: 0, pageSize: 10},
+		{name: "NegativePage", pageNum: -1, pageSize: 10},
+		{name: "ZeroLimit", pageNum: 1, pageSize: 0},
+		{name: "LimitTooLarge", pageNum: 1, pageSize: MaxPageSize + 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := repository.FindPage(tc.pageNum, tc.pageSize, nil, nil, nil)
+			require.ErrorIs(t, err, ErrInvalidPage)
+		})
+	}
+}
+
+func TestRepositoryFindAll(t *testing.T) {
+	db := dryRunDB(t)
+	statements := recordQueries(t, db)
+	repository := NewRepository[models.User](db)
+
+	users, err := repository.FindAll(func(query *gorm.DB) *gorm.DB {
+		return query.Where("email = ?", "a@b.c").Limit(1)
+	}, nil)
+	require.NoError(t, err)
+	require.NotNil(t, users)
+	require.Empty(t, users)
+
+	// Soft deleted users are excluded through the model
+	require.Len(t, *statements, 1)
+	require.Contains(t, (*statements)[0], `FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL LIMIT 1`)
+}
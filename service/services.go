@@ -1,20 +1,34 @@
 package service
 
 import (
+	"github.com/dbsSensei/filesystem-api/mailer"
 	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/storage"
 	"gorm.io/gorm"
 )
 
 type Services struct {
-	UserService       IRepository
-	TokenService      IRepository
-	FilesystemService IRepository
+	UserService          IRepository[models.User]
+	TokenService         IRepository[models.Token]
+	FilesystemService    IRepository[models.Filesystem]
+	FolderService        IRepository[models.Folder]
+	ShareLinkService     IRepository[models.ShareLink]
+	ExtractionJobService IRepository[models.ExtractionJob]
+	UploadService        IRepository[models.Upload]
+	Storage              storage.Backend
+	Mailer               mailer.Mailer
 }
 
-func Init(db *gorm.DB) *Services {
+func Init(db *gorm.DB, store storage.Backend, mail mailer.Mailer) *Services {
 	return &Services{
-		UserService:       NewRepository(&models.User{}, db),
-		TokenService:      NewRepository(&models.Token{}, db),
-		FilesystemService: NewRepository(&models.Filesystem{}, db),
+		UserService:          NewRepository[models.User](db),
+		TokenService:         NewRepository[models.Token](db),
+		FilesystemService:    NewRepository[models.Filesystem](db),
+		FolderService:        NewRepository[models.Folder](db),
+		ShareLinkService:     NewRepository[models.ShareLink](db),
+		ExtractionJobService: NewRepository[models.ExtractionJob](db),
+		UploadService:        NewRepository[models.Upload](db),
+		Storage:              store,
+		Mailer:               mail,
 	}
 }
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, the session is revoked")
+)
+
+// RotateRefreshToken checks a refresh token against the one stored for its payload and
+// marks it as rotated, so it can only be exchanged once. Exchanging a token that was
+// already rotated means it leaked: the whole session is revoked and ErrRefreshTokenReused
+// is returned, the transaction must still be committed for the revocation to stick.
+func RotateRefreshToken(tx *gorm.DB, payload *utils.TokenPayload, refreshToken string) (*models.Token, error) {
+	var tokens []models.Token
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", payload.Id).Limit(1).Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	token := &tokens[0]
+	if token.RefreshToken != refreshToken || token.UserID != payload.UserId || token.SessionID != payload.SessionId {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if token.RotatedAt != nil {
+		if err := RevokeSession(tx, token.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if token.IsBlocked || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	now := time.Now()
+	token.RotatedAt = &now
+	if err := tx.Model(token).Update("rotated_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Session is an active session, described by its latest refresh token
+type Session struct {
+	models.Token
+	// StartedAt is when the user signed in, the token is refreshed since
+	StartedAt time.Time
+}
+
+// ActiveSessions returns the sessions of the user that can still be refreshed, newest first
+func ActiveSessions(db *gorm.DB, userID int) ([]Session, error) {
+	var sessions []Session
+	err := db.Model(&models.Token{}).
+		Select("tokens.*, (SELECT MIN(started.created_at) FROM tokens started WHERE started.session_id = tokens.session_id) AS started_at").
+		Where("user_id = ? AND is_blocked = ? AND rotated_at IS NULL AND expires_at > ?", userID, false, time.Now()).
+		Order("started_at desc").
+		Scan(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession blocks every refresh token of a session
+func RevokeSession(tx *gorm.DB, sessionID uuid.UUID) error {
+	return tx.Model(&models.Token{}).Where("session_id = ?", sessionID).Update("is_blocked", true).Error
+}
+
+// RevokeUserSessions blocks the latest refresh token of every session of the user, which
+// revokes them, and returns how many were still active
+func RevokeUserSessions(tx *gorm.DB, userID int) (int64, error) {
+	result := tx.Model(&models.Token{}).
+		Where("user_id = ? AND is_blocked = ? AND rotated_at IS NULL", userID, false).
+		Update("is_blocked", true)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+
+	"github.com/dbsSensei/filesystem-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SessionStore tells whether the session of an access token was revoked
+type SessionStore interface {
+	IsSessionRevoked(ctx context.Context, sessionID uuid.UUID) (bool, error)
+}
+
+// dbSessionStore looks the sessions up in the tokens table
+type dbSessionStore struct {
+	db *gorm.DB
+}
+
+func NewSessionStore(db *gorm.DB) SessionStore {
+	return &dbSessionStore{db: db}
+}
+
+// IsSessionRevoked reports whether the refresh tokens of the session were blocked by a
+// logout, a revocation or a replayed refresh token. Every token is issued for a session,
+// tokens without one can not be revoked and are rejected.
+func (s *dbSessionStore) IsSessionRevoked(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	if sessionID == uuid.Nil {
+		return true, nil
+	}
+
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.Token{}).
+		Where("session_id = ? AND is_blocked = ?", sessionID, true).
+		Limit(1).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateRefreshTokenUnknown(t *testing.T) {
+	db := dryRunDB(t)
+	statements := recordQueries(t, db)
+
+	payload, err := utils.NewPayload(1, uuid.New(), utils.TokenTypeRefresh, time.Minute)
+	require.NoError(t, err)
+
+	// A refresh token without a stored row is rejected, the row is locked while it is checked
+	_, err = RotateRefreshToken(db, payload, "token")
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+	require.Len(t, *statements, 1)
+	require.Contains(t, (*statements)[0], "FOR UPDATE")
+}
+
+func TestIsSessionRevokedWithoutSession(t *testing.T) {
+	db := dryRunDB(t)
+	statements := recordQueries(t, db)
+
+	// Tokens issued without a session are rejected without looking them up
+	revoked, err := NewSessionStore(db).IsSessionRevoked(context.Background(), uuid.Nil)
+	require.NoError(t, err)
+	require.True(t, revoked)
+	require.Empty(t, *statements)
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// MemoryBackend keeps objects in memory, it is meant for development and tests
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+// NewMemoryBackend creates a new empty MemoryBackend
+func NewMemoryBackend() Backend {
+	return &MemoryBackend{
+		objects: make(map[string]memoryObject),
+	}
+}
+
+func (m *MemoryBackend) Put(_ context.Context, key string, r io.Reader, _ int64) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = memoryObject{
+		data:    data,
+		modTime: time.Now(),
+	}
+	return nil
+}
+
+// memoryReader reads the content of a memory object
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error {
+	return nil
+}
+
+func (m *MemoryBackend) Get(_ context.Context, key string) (Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	object, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return memoryReader{bytes.NewReader(object.data)}, nil
+}
+
+func (m *MemoryBackend) Stat(_ context.Context, key string) (*ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	object, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &ObjectInfo{
+		Key:     key,
+		Size:    int64(len(object.data)),
+		ModTime: object.modTime,
+	}, nil
+}
+
+func (m *MemoryBackend) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.objects[key]; !ok {
+		return ErrNotFound
+	}
+
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *MemoryBackend) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var objects []ObjectInfo
+	for key, object := range m.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		objects = append(objects, ObjectInfo{
+			Key:     key,
+			Size:    int64(len(object.data)),
+			ModTime: object.modTime,
+		})
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/config"
+	"github.com/dbsSensei/filesystem-api/utils"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// minS3PartSize is the smallest part size accepted by S3 for multipart uploads
+const minS3PartSize = 5 * 1024 * 1024
+
+// S3Backend stores objects in an S3-compatible bucket
+type S3Backend struct {
+	client   *minio.Client
+	bucket   string
+	partSize uint64
+}
+
+// NewS3Backend creates a new S3Backend from the S3 settings in the config,
+// creating the bucket when it does not exist yet
+func NewS3Backend(c *config.Config) (Backend, error) {
+	if c.S3Endpoint == "" || c.S3Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket must be provided")
+	}
+
+	bucketLookup := minio.BucketLookupAuto
+	if c.S3ForcePathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(c.S3Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(c.S3AccessKeyID, c.S3SecretAccessKey, ""),
+		Secure:       c.S3UseSSL,
+		Region:       c.S3Region,
+		BucketLookup: bucketLookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	partSize := uint64(c.S3PartSize)
+	if partSize < minS3PartSize {
+		partSize = minS3PartSize
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	exists, err := client.BucketExists(ctx, c.S3Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check s3 bucket: %w", err)
+	}
+
+	if !exists {
+		err = client.MakeBucket(ctx, c.S3Bucket, minio.MakeBucketOptions{Region: c.S3Region})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create s3 bucket: %w", err)
+		}
+	}
+
+	return &S3Backend{
+		client:   client,
+		bucket:   c.S3Bucket,
+		partSize: partSize,
+	}, nil
+}
+
+// toStorageError maps missing object responses to ErrNotFound
+func toStorageError(err error) error {
+	response := minio.ToErrorResponse(err)
+	if response.Code == "NoSuchKey" || response.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Put streams r to the bucket. Objects bigger than the part size, or of unknown
+// size, are sent as a multipart upload without buffering the whole object.
+func (s *S3Backend) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    s.partSize,
+	})
+	return err
+}
+
+func (s *S3Backend) Get(ctx context.Context, key string) (Object, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, toStorageError(err)
+	}
+
+	// GetObject is lazy, stat the object to surface missing keys right away
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, toStorageError(err)
+	}
+
+	return object, nil
+}
+
+func (s *S3Backend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, toStorageError(err)
+	}
+
+	return &ObjectInfo{
+		Key:     info.Key,
+		Size:    info.Size,
+		ModTime: info.LastModified,
+	}, nil
+}
+
+func (s *S3Backend) Delete(ctx context.Context, key string) error {
+	// S3 does not report missing keys on delete, stat first to keep the Backend contract
+	if _, err := s.Stat(ctx, key); err != nil {
+		return err
+	}
+
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+
+		objects = append(objects, ObjectInfo{
+			Key:     info.Key,
+			Size:    info.Size,
+			ModTime: info.LastModified,
+		})
+	}
+
+	return objects, nil
+}
+
+// PresignGet returns a URL that downloads the object directly from the bucket
+// as an attachment named filename
+func (s *S3Backend) PresignGet(ctx context.Context, key string, filename string, expiry time.Duration) (*url.URL, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", utils.ContentDisposition("attachment", filename))
+
+	return s.client.PresignedGetObject(ctx, s.bucket, key, expiry, params)
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/dbsSensei/filesystem-api/config"
+	"github.com/google/uuid"
+)
+
+// Different types of backend supported by New
+const (
+	BackendLocal  = "local"
+	BackendMemory = "memory"
+	BackendS3     = "s3"
+)
+
+// ErrNotFound is returned when the requested object does not exist in the backend
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes an object stored in a backend
+type ObjectInfo struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Object is the content of a stored object, it can be read sequentially, seeked
+// to serve byte ranges, or read at arbitrary offsets to open archive entries
+type Object interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
+// NewKey returns a new unique key for an object of the user under prefix. Keys never
+// contain the names chosen by users, so two objects can not be stored under the same key.
+func NewKey(prefix string, userID int) string {
+	return fmt.Sprintf("%s%d/%s", prefix, userID, uuid.New())
+}
+
+// Backend is an interface for storing file contents
+type Backend interface {
+	// Put stores the content of r under key, replacing any existing object.
+	// size is the number of bytes r will yield, or -1 if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+
+	// Get opens the object stored under key for reading
+	Get(ctx context.Context, key string) (Object, error)
+
+	// Stat returns the information of the object stored under key
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+
+	// Delete removes the object stored under key
+	Delete(ctx context.Context, key string) error
+
+	// List returns every object whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// Presigner is implemented by backends able to hand out direct download URLs
+type Presigner interface {
+	// PresignGet returns a URL valid for expiry that downloads the object stored
+	// under key as an attachment named filename
+	PresignGet(ctx context.Context, key string, filename string, expiry time.Duration) (*url.URL, error)
+}
+
+// New creates the storage backend selected in the config
+func New(c *config.Config) (Backend, error) {
+	switch c.StorageBackend {
+	case BackendLocal, "":
+		return NewLocalBackend(c.StorageLocalPath)
+	case BackendMemory:
+		return NewMemoryBackend(), nil
+	case BackendS3:
+		return NewS3Backend(c)
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", c.StorageBackend)
+	}
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testBackend(t *testing.T, backend Backend) {
+	ctx := context.Background()
+
+	content := "hello filesystem"
+	err := backend.Put(ctx, "1/a.txt", strings.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	err = backend.Put(ctx, "1/b.txt", strings.NewReader("b"), -1)
+	require.NoError(t, err)
+
+	err = backend.Put(ctx, "2/c.txt", strings.NewReader("c"), 1)
+	require.NoError(t, err)
+
+	reader, err := backend.Get(ctx, "1/a.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, content, string(data))
+
+	_, err = reader.Seek(6, io.SeekStart)
+	require.NoError(t, err)
+	data, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "filesystem", string(data))
+
+	part := make([]byte, 5)
+	_, err = reader.ReadAt(part, 0)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "hello", string(part))
+
+	info, err := backend.Stat(ctx, "1/a.txt")
+	require.NoError(t, err)
+	require.Equal(t, "1/a.txt", info.Key)
+	require.Equal(t, int64(len(content)), info.Size)
+	require.NotZero(t, info.ModTime)
+
+	objects, err := backend.List(ctx, "1/")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	require.Equal(t, "1/a.txt", objects[0].Key)
+	require.Equal(t, "1/b.txt", objects[1].Key)
+
+	err = backend.Delete(ctx, "1/a.txt")
+	require.NoError(t, err)
+
+	_, err = backend.Get(ctx, "1/a.txt")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = backend.Stat(ctx, "1/a.txt")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	err = backend.Delete(ctx, "1/a.txt")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalBackend(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	require.NoError(t, err)
+
+	testBackend(t, backend)
+}
+
+func TestLocalBackendInvalidKey(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	require.NoError(t, err)
+
+	err = backend.Put(context.Background(), "../escape.txt", strings.NewReader("x"), 1)
+	require.Error(t, err)
+
+	_, err = backend.Get(context.Background(), "/etc/passwd")
+	require.Error(t, err)
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testBackend(t, NewMemoryBackend())
+}
+
+func TestNewKey(t *testing.T) {
+	key := NewKey("archives/", 7)
+	require.Regexp(t, `^archives/7/[0-9a-f-]{36}$`, key)
+	require.NotEqual(t, key, NewKey("archives/", 7))
+}
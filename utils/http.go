@@ -5,7 +5,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/natefinch/lumberjack"
 	"math"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -56,6 +59,196 @@ func Paginate(count int64, pageNum int, pageSize int) Pagination {
 	return pagination
 }
 
+// ContentDisposition formats a Content-Disposition header value as described in
+// RFC 6266. Names that are not plain ASCII get an ASCII fallback in filename and
+// the UTF-8 name percent-encoded in filename*.
+func ContentDisposition(dispositionType string, filename string) string {
+	var fallback, encoded strings.Builder
+	ascii := true
+
+	for _, r := range filename {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			ascii = false
+			fallback.WriteByte('_')
+		case r >= 0x80:
+			ascii = false
+			fallback.WriteByte('_')
+		case r == '"' || r == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(r)
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+
+	value := fmt.Sprintf(`%s; filename="%s"`, dispositionType, fallback.String())
+	if ascii {
+		return value
+	}
+
+	for _, b := range []byte(filename) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return value + "; filename*=UTF-8''" + encoded.String()
+}
+
+// isAttrChar reports whether b can appear unescaped in an RFC 5987 ext-value
+func isAttrChar(b byte) bool {
+	switch {
+	case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
+
+// StrongETag formats a content hash as a strong entity tag
+func StrongETag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// IsFullDownload reports whether http.ServeContent answers a GET request for content of
+// the given size, entity tag and modification time with its first byte. Requests answered
+// with 304 Not Modified or 412 Precondition Failed, unsatisfiable ranges and ranges
+// resuming a download past the first byte are not full downloads.
+func IsFullDownload(r *http.Request, etag string, modTime time.Time, size int64) bool {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !etagListMatch(ifMatch, etag) {
+			return false
+		}
+	} else if ifUnmodifiedSince := r.Header.Get("If-Unmodified-Since"); ifUnmodifiedSince != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ifUnmodifiedSince)
+		if err == nil && modTime.Truncate(time.Second).After(t) {
+			return false
+		}
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagListMatch(ifNoneMatch, etag) {
+			return false
+		}
+	} else if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ifModifiedSince)
+		if err == nil && !modTime.Truncate(time.Second).After(t) {
+			return false
+		}
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" {
+		return true
+	}
+
+	// A stale If-Range makes the whole content be sent
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && !ifRangeMatch(ifRange, etag, modTime) {
+		return true
+	}
+
+	return rangesFromStart(rangeHeader, size)
+}
+
+// rangesFromStart resolves a Range header against the content size as http.ServeContent
+// does, and reports whether the served ranges include the first byte
+func rangesFromStart(rangeHeader string, size int64) bool {
+	spec, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok {
+		return false
+	}
+
+	fromStart, noOverlap := false, false
+	served, total := 0, int64(0)
+	for _, ra := range strings.Split(spec, ",") {
+		ra = strings.TrimSpace(ra)
+		if ra == "" {
+			continue
+		}
+		startSpec, endSpec, ok := strings.Cut(ra, "-")
+		if !ok {
+			return false
+		}
+		startSpec, endSpec = strings.TrimSpace(startSpec), strings.TrimSpace(endSpec)
+
+		var start, length int64
+		if startSpec == "" {
+			// A suffix range longer than the content covers all of it
+			if endSpec == "" || endSpec[0] == '-' {
+				return false
+			}
+			n, err := strconv.ParseInt(endSpec, 10, 64)
+			if err != nil || n < 0 {
+				return false
+			}
+			if n > size {
+				n = size
+			}
+			start, length = size-n, n
+		} else {
+			i, err := strconv.ParseInt(startSpec, 10, 64)
+			if err != nil || i < 0 {
+				return false
+			}
+			if i >= size {
+				noOverlap = true
+				continue
+			}
+			start, length = i, size-i
+			if endSpec != "" {
+				j, err := strconv.ParseInt(endSpec, 10, 64)
+				if err != nil || i > j {
+					return false
+				}
+				if j >= size {
+					j = size - 1
+				}
+				length = j - i + 1
+			}
+		}
+
+		served++
+		total += length
+		if start == 0 {
+			fromStart = true
+		}
+	}
+
+	// Ranges that all start past the content are answered with 416, an empty list and
+	// ranges adding up to more than the content with all of it
+	if served == 0 {
+		return !noOverlap
+	}
+	return fromStart || total > size
+}
+
+// etagListMatch reports whether an If-None-Match list matches etag, with the weak
+// comparison of RFC 7232
+func etagListMatch(list string, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if etag != "" && strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ifRangeMatch reports whether an If-Range validator, an entity tag compared strongly
+// or a date, still matches the content
+func ifRangeMatch(ifRange string, etag string, modTime time.Time) bool {
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return etag != "" && !strings.HasPrefix(ifRange, "W/") && ifRange == etag
+	}
+
+	t, err := http.ParseTime(ifRange)
+	return err == nil && !modTime.IsZero() && modTime.Truncate(time.Second).Equal(t)
+}
+
 func Logger() gin.HandlerFunc {
 	// Create a new log file
 	logFile, err := os.OpenFile(
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentDisposition(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filename string
+		expected string
+	}{
+		{
+			name:     "ASCII",
+			filename: "report 2023.pdf",
+			expected: `attachment; filename="report 2023.pdf"`,
+		},
+		{
+			name:     "Quotes",
+			filename: `say "hi"\.txt`,
+			expected: `attachment; filename="say \"hi\"\\.txt"`,
+		},
+		{
+			name:     "UTF8",
+			filename: "résumé.txt",
+			expected: `attachment; filename="r_sum_.txt"; filename*=UTF-8''r%C3%A9sum%C3%A9.txt`,
+		},
+		{
+			name:     "HeaderInjection",
+			filename: "a\r\nSet-Cookie: x.txt",
+			expected: `attachment; filename="a__Set-Cookie: x.txt"; filename*=UTF-8''a%0D%0ASet-Cookie%3A%20x.txt`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, ContentDisposition("attachment", tc.filename))
+		})
+	}
+}
+
+func TestStrongETag(t *testing.T) {
+	require.Equal(t, `"abc"`, StrongETag("abc"))
+}
+
+func TestIsFullDownload(t *testing.T) {
+	etag := StrongETag("abc")
+	modTime := time.Date(2023, 7, 1, 12, 0, 0, 500, time.UTC)
+	lastModified := modTime.Format(http.TimeFormat)
+
+	testCases := []struct {
+		name    string
+		headers map[string]string
+		full    bool
+	}{
+		{name: "Plain", full: true},
+		{name: "MatchingETag", headers: map[string]string{"If-None-Match": `"other", W/"abc"`}},
+		{name: "StaleETag", headers: map[string]string{"If-None-Match": `"other"`}, full: true},
+		{name: "NotModifiedSince", headers: map[string]string{"If-Modified-Since": lastModified}},
+		{name: "ModifiedSince", headers: map[string]string{"If-Modified-Since": modTime.Add(-time.Hour).Format(http.TimeFormat)}, full: true},
+		{name: "RangeFromStart", headers: map[string]string{"Range": "bytes=0-3"}, full: true},
+		{name: "RangeContinuation", headers: map[string]string{"Range": "bytes=4-"}},
+		{name: "SuffixRange", headers: map[string]string{"Range": "bytes=-2"}},
+		{name: "LargeSuffixRange", headers: map[string]string{"Range": "bytes=-20"}, full: true},
+		{name: "WholeSuffixRange", headers: map[string]string{"Range": "bytes=-10"}, full: true},
+		{name: "MultiRangeWithStart", headers: map[string]string{"Range": "bytes=1-,0-0"}, full: true},
+		{name: "MultiRangeContinuation", headers: map[string]string{"Range": "bytes=4-5,7-"}},
+		{name: "OverlappingRanges", headers: map[string]string{"Range": "bytes=1-8,2-9"}, full: true},
+		{name: "RangePastEnd", headers: map[string]string{"Range": "bytes=20-"}},
+		{name: "InvalidRange", headers: map[string]string{"Range": "bytes=5-2"}},
+		{name: "EmptyRange", headers: map[string]string{"Range": "bytes="}, full: true},
+		{name: "FailedIfMatch", headers: map[string]string{"If-Match": `"other"`}},
+		{name: "StaleIfRange", headers: map[string]string{"Range": "bytes=4-", "If-Range": `"other"`}, full: true},
+		{name: "MatchingIfRange", headers: map[string]string{"Range": "bytes=4-", "If-Range": etag}},
+		{name: "MatchingIfRangeDate", headers: map[string]string{"Range": "bytes=4-", "If-Range": lastModified}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			for key, value := range tc.headers {
+				request.Header.Set(key, value)
+			}
+			require.Equal(t, tc.full, IsFullDownload(request, etag, modTime, 10))
+
+			// The answer of ServeContent agrees, a multipart answer is full when one of its parts starts the content
+			recorder := httptest.NewRecorder()
+			recorder.Header().Set("ETag", etag)
+			http.ServeContent(recorder, request, "file.txt", modTime, strings.NewReader("0123456789"))
+			full := recorder.Code == http.StatusOK ||
+				strings.HasPrefix(recorder.Header().Get("Content-Range"), "bytes 0-") ||
+				(recorder.Code == http.StatusPartialContent && strings.Contains(recorder.Body.String(), "Content-Range: bytes 0-"))
+			require.Equal(t, tc.full, full)
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	pagination := Paginate(25, 2, 10)
+	require.Equal(t, Pagination{TotalItems: 25, TotalPages: 3, PageSize: 10, PageNum: 2, HasPrev: true, HasNext: true}, pagination)
+
+	pagination = Paginate(25, 3, 10)
+	require.False(t, pagination.HasNext)
+
+	pagination = Paginate(0, 1, 10)
+	require.Equal(t, Pagination{PageSize: 10, PageNum: 1}, pagination)
+}
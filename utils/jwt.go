@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 	"time"
 )
 
@@ -22,9 +23,9 @@ func NewJWTMaker(secretKey string) (TokenMaker, error) {
 	return &JWTMaker{secretKey}, nil
 }
 
-// CreateToken creates a new tokens for a specific username and duration
-func (maker *JWTMaker) CreateToken(userId int, duration time.Duration) (string, *TokenPayload, error) {
-	payload, err := NewPayload(userId, duration)
+// CreateToken creates a new tokens for a specific user, session, type and duration
+func (maker *JWTMaker) CreateToken(userId int, sessionId uuid.UUID, tokenType TokenType, duration time.Duration) (string, *TokenPayload, error) {
+	payload, err := NewPayload(userId, sessionId, tokenType, duration)
 	if err != nil {
 		return "", payload, err
 	}
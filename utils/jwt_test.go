@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -12,13 +13,14 @@ func TestJWTMaker(t *testing.T) {
 	maker, err := NewJWTMaker(RandomString(32))
 	require.NoError(t, err)
 
-	userId := int32(RandomInt(0, 10))
+	userId := int(RandomInt(0, 10))
+	sessionId := uuid.New()
 	duration := time.Minute
 
 	issuedAt := time.Now()
 	expiredAt := issuedAt.Add(duration)
 
-	token, payload, err := maker.CreateToken(int32(userId), duration)
+	token, payload, err := maker.CreateToken(userId, sessionId, TokenTypeAccess, duration)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
 	require.NotEmpty(t, payload)
@@ -29,6 +31,8 @@ func TestJWTMaker(t *testing.T) {
 
 	require.NotZero(t, payload.Id)
 	require.Equal(t, userId, payload.UserId)
+	require.Equal(t, sessionId, payload.SessionId)
+	require.Equal(t, TokenTypeAccess, payload.Type)
 	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
 	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
 }
@@ -37,7 +41,7 @@ func TestExpiredJWTToken(t *testing.T) {
 	maker, err := NewJWTMaker(RandomString(32))
 	require.NoError(t, err)
 
-	token, payload, err := maker.CreateToken(int32(RandomInt(0, 10)), -time.Minute)
+	token, payload, err := maker.CreateToken(int(RandomInt(0, 10)), uuid.New(), TokenTypeAccess, -time.Minute)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
 	require.NotEmpty(t, payload)
@@ -49,7 +53,7 @@ func TestExpiredJWTToken(t *testing.T) {
 }
 
 func TestInvalidJWTTokenAlgNone(t *testing.T) {
-	payload, err := NewPayload(int32(RandomInt(0, 10)), time.Minute)
+	payload, err := NewPayload(int(RandomInt(0, 10)), uuid.New(), TokenTypeAccess, time.Minute)
 	require.NoError(t, err)
 
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodNone, payload)
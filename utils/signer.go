@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Different types of error returned by the Verify function
+var (
+	ErrInvalidSignature = errors.New("signature is invalid")
+	ErrExpiredSignature = errors.New("signature has expired")
+)
+
+// Signer signs resource ids with an expiry time using HMAC-SHA256
+type Signer struct {
+	secretKey []byte
+}
+
+// NewSigner creates a new Signer
+func NewSigner(secretKey string) (*Signer, error) {
+	if len(secretKey) < minSecretKeySize {
+		return nil, fmt.Errorf("invalid key size: must be at least %d characters", minSecretKeySize)
+	}
+	return &Signer{[]byte(secretKey)}, nil
+}
+
+func (signer *Signer) mac(id int, expiresAt time.Time) []byte {
+	mac := hmac.New(sha256.New, signer.secretKey)
+	mac.Write([]byte(strconv.Itoa(id) + ":" + strconv.FormatInt(expiresAt.Unix(), 10)))
+	return mac.Sum(nil)
+}
+
+// Sign returns the url-safe signature of the id valid until expiresAt
+func (signer *Signer) Sign(id int, expiresAt time.Time) string {
+	return base64.RawURLEncoding.EncodeToString(signer.mac(id, expiresAt))
+}
+
+// Verify checks if the signature matches the id and has not expired yet
+func (signer *Signer) Verify(id int, expiresAt time.Time, signature string) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal(decoded, signer.mac(id, expiresAt)) {
+		return ErrInvalidSignature
+	}
+
+	if time.Now().After(expiresAt) {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
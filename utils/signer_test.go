@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner(t *testing.T) {
+	signer, err := NewSigner(RandomString(32))
+	require.NoError(t, err)
+
+	id := int(RandomInt(1, 1000))
+	expiresAt := time.Now().Add(time.Minute)
+
+	signature := signer.Sign(id, expiresAt)
+	require.NotEmpty(t, signature)
+	require.NoError(t, signer.Verify(id, expiresAt, signature))
+
+	require.EqualError(t, signer.Verify(id+1, expiresAt, signature), ErrInvalidSignature.Error())
+	require.EqualError(t, signer.Verify(id, expiresAt.Add(time.Second), signature), ErrInvalidSignature.Error())
+	require.EqualError(t, signer.Verify(id, expiresAt, "not-a-signature"), ErrInvalidSignature.Error())
+
+	otherSigner, err := NewSigner(RandomString(32))
+	require.NoError(t, err)
+	require.EqualError(t, otherSigner.Verify(id, expiresAt, signature), ErrInvalidSignature.Error())
+}
+
+func TestExpiredSignature(t *testing.T) {
+	signer, err := NewSigner(RandomString(32))
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	signature := signer.Sign(1, expiresAt)
+
+	require.EqualError(t, signer.Verify(1, expiresAt, signature), ErrExpiredSignature.Error())
+}
+
+func TestSignerInvalidKeySize(t *testing.T) {
+	_, err := NewSigner(RandomString(10))
+	require.Error(t, err)
+}
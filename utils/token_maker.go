@@ -13,16 +13,28 @@ var (
 	ErrExpiredToken = errors.New("tokens has expired")
 )
 
+// TokenType tells what a token can be used for
+type TokenType string
+
+const (
+	// TokenTypeAccess tokens authorize the requests of a session
+	TokenTypeAccess TokenType = "access"
+	// TokenTypeRefresh tokens are only exchanged for a new token pair
+	TokenTypeRefresh TokenType = "refresh"
+)
+
 // TokenPayload contains the payload data of the tokens
 type TokenPayload struct {
 	Id        uuid.UUID `json:"id"`
 	UserId    int       `json:"user_id"`
+	SessionId uuid.UUID `json:"session_id"`
+	Type      TokenType `json:"type"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiredAt time.Time `json:"expired_at"`
 }
 
-// NewPayload creates a new tokens payload with a specific username and duration
-func NewPayload(userId int, duration time.Duration) (*TokenPayload, error) {
+// NewPayload creates a new tokens payload with a specific user, session, type and duration
+func NewPayload(userId int, sessionId uuid.UUID, tokenType TokenType, duration time.Duration) (*TokenPayload, error) {
 	tokenId, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -31,6 +43,8 @@ func NewPayload(userId int, duration time.Duration) (*TokenPayload, error) {
 	payload := &TokenPayload{
 		Id:        tokenId,
 		UserId:    userId,
+		SessionId: sessionId,
+		Type:      tokenType,
 		IssuedAt:  time.Now(),
 		ExpiredAt: time.Now().Add(duration),
 	}
@@ -47,8 +61,8 @@ func (payload *TokenPayload) Valid() error {
 
 // TokenMaker is an interface for managing tokens
 type TokenMaker interface {
-	// CreateToken creates a new tokens for a specific username and duration
-	CreateToken(userId int, duration time.Duration) (string, *TokenPayload, error)
+	// CreateToken creates a new tokens for a specific user, session, type and duration
+	CreateToken(userId int, sessionId uuid.UUID, tokenType TokenType, duration time.Duration) (string, *TokenPayload, error)
 
 	// VerifyToken checks if the tokens is valid or not
 	VerifyToken(token string) (*TokenPayload, error)
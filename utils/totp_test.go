@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHOTP(t *testing.T) {
+	// Test vectors of RFC 4226 appendix D
+	key := []byte("12345678901234567890")
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range expected {
+		require.Equal(t, code, hotp(key, uint64(counter), 6))
+	}
+
+	// Test vectors of RFC 6238 appendix B, for SHA1
+	vectors := map[int64]string{
+		59:         "94287082",
+		1111111109: "07081804",
+		1111111111: "14050471",
+		1234567890: "89005924",
+		2000000000: "69279037",
+	}
+	for unix, code := range vectors {
+		step := TOTPStep(time.Unix(unix, 0))
+		require.Equal(t, code, hotp(key, uint64(step), 8))
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	require.Len(t, secret, 32)
+
+	now := time.Now()
+	code, err := TOTPCode(secret, TOTPStep(now))
+	require.NoError(t, err)
+
+	step, ok := ValidateTOTP(secret, code, now)
+	require.True(t, ok)
+	require.Equal(t, TOTPStep(now), step)
+
+	// The code of the previous period is still accepted, older ones are not
+	_, ok = ValidateTOTP(secret, code, now.Add(TOTPPeriod))
+	require.True(t, ok)
+	_, ok = ValidateTOTP(secret, code, now.Add(3*TOTPPeriod))
+	require.False(t, ok)
+
+	_, ok = ValidateTOTP(secret, "12345", now)
+	require.False(t, ok)
+	_, ok = ValidateTOTP("not base32!", "123456", now)
+	require.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("Filesystem API", "user@example.com", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", uri.Scheme)
+	require.Equal(t, "totp", uri.Host)
+	require.Equal(t, "/Filesystem API:user@example.com", uri.Path)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	require.Equal(t, "Filesystem API", uri.Query().Get("issuer"))
+	require.Equal(t, "6", uri.Query().Get("digits"))
+}